@@ -0,0 +1,132 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+const (
+	// DefaultAppImage is the bestie app image used when the config does not set one.
+	DefaultAppImage = "quay.io/mkong/bestiev2"
+	// DefaultAppVersion is the bestie app image tag used when the config does not set one.
+	DefaultAppVersion = "1.1"
+	// DefaultDatabaseStorage is the size of the bestie database volume used when the config does not set one.
+	DefaultDatabaseStorage = "1Gi"
+	// DefaultAppNotReadyRequeue is how long to wait before checking a bestie app that isn't running yet.
+	DefaultAppNotReadyRequeue = 5 * time.Second
+	// DefaultMaxBackoff caps the delay between the checks of a waiting Bestie.
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultReadyRequeue is how long to wait before re-checking a fully reconciled Bestie.
+	DefaultReadyRequeue = 10 * time.Minute
+)
+
+// BestieDefaults holds the operator-wide defaults applied to every Bestie.
+type BestieDefaults struct {
+	// AppImage is the bestie app container image, without a tag.
+	AppImage string `json:"appImage,omitempty"`
+
+	// AppVersion is the bestie app image tag.
+	AppVersion string `json:"appVersion,omitempty"`
+
+	// AppResources are the compute resources of the bestie app container.
+	AppResources corev1.ResourceRequirements `json:"appResources,omitempty"`
+
+	// DatabaseStorage is the size of the bestie database volume.
+	DatabaseStorage resource.Quantity `json:"databaseStorage,omitempty"`
+
+	// BackupSchedule is the cron schedule of full pgBackRest backups of the
+	// bestie database. Scheduled backups are disabled when empty.
+	BackupSchedule string `json:"backupSchedule,omitempty"`
+
+	// Requeue holds the intervals after which a Bestie is reconciled again.
+	Requeue RequeueIntervals `json:"requeue,omitempty"`
+}
+
+// RequeueIntervals holds the intervals after which a Bestie is reconciled again.
+type RequeueIntervals struct {
+	// AppNotReady is the delay before checking a bestie app that isn't running
+	// yet, or whose database isn't ready. Readiness changes are picked up
+	// through watches; this check is a fallback and doubles on every retry.
+	AppNotReady metav1.Duration `json:"appNotReady,omitempty"`
+
+	// MaxBackoff caps the delay between the checks of a Bestie that keeps
+	// waiting for its app or database.
+	MaxBackoff metav1.Duration `json:"maxBackoff,omitempty"`
+
+	// Ready is the delay before re-checking a fully reconciled Bestie. It
+	// bounds how long the app pods keep running with stale unlabelled
+	// Secrets or ConfigMaps, whose changes are not watched. Periodic
+	// requeues are disabled when negative.
+	Ready metav1.Duration `json:"ready,omitempty"`
+}
+
+// SetDefaults fills in every field left empty in the config file.
+func (d *BestieDefaults) SetDefaults() {
+	if d.AppImage == "" {
+		d.AppImage = DefaultAppImage
+	}
+	if d.AppVersion == "" {
+		d.AppVersion = DefaultAppVersion
+	}
+	if d.AppResources.Limits == nil && d.AppResources.Requests == nil {
+		d.AppResources = corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("512Mi"),
+			},
+		}
+	}
+	if d.DatabaseStorage.IsZero() {
+		d.DatabaseStorage = resource.MustParse(DefaultDatabaseStorage)
+	}
+	if d.Requeue.AppNotReady.Duration == 0 {
+		d.Requeue.AppNotReady.Duration = DefaultAppNotReadyRequeue
+	}
+	if d.Requeue.MaxBackoff.Duration == 0 {
+		d.Requeue.MaxBackoff.Duration = DefaultMaxBackoff
+	}
+	if d.Requeue.Ready.Duration == 0 {
+		d.Requeue.Ready.Duration = DefaultReadyRequeue
+	}
+}
+
+//+kubebuilder:object:root=true
+
+// BestieOperatorConfig is the Schema for the l5-operator component config.
+// It extends the controller-runtime ControllerManagerConfig with operator-wide defaults.
+type BestieOperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec returns the configurations for controllers
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// Defaults are applied to every Bestie managed by the operator.
+	Defaults BestieDefaults `json:"defaults,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BestieOperatorConfig{})
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+
+	v2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// conversionData is the content of the v2 conversion data annotation.
+type conversionData struct {
+	Spec   v2.BestieSpec   `json:"spec"`
+	Status v2.BestieStatus `json:"status,omitempty"`
+}
+
+var _ conversion.Convertible = &Bestie{}
+
+// ConvertTo converts this Bestie to the Hub version (v2). Fields v1 cannot
+// represent are restored from the conversion data annotation, if any.
+func (src *Bestie) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v2.Bestie)
+	in := src.DeepCopy()
+
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = v2.BestieSpec{}
+	dst.Status = v2.BestieStatus{}
+	if raw, ok := dst.Annotations[v2.ConversionDataAnnotation]; ok {
+		var data conversionData
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return err
+		}
+		dst.Spec, dst.Status = data.Spec, data.Status
+		delete(dst.Annotations, v2.ConversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	// Every field v1 has wins over the annotation, which may be stale after
+	// the object was edited through v1.
+	spec := &dst.Spec
+	spec.AgencyName = in.Spec.AgencyName
+	spec.App.Replicas = in.Spec.Size
+	spec.App.Image = in.Spec.App.Image
+	spec.App.Version = in.Spec.App.Version
+	spec.App.Resources = in.Spec.App.Resources
+	spec.App.Autoscaling = v2.AutoscalingSpec{
+		Enabled:                        in.Spec.Autoscaling.Enabled,
+		MinReplicas:                    in.Spec.Autoscaling.MinReplicas,
+		MaxReplicas:                    in.Spec.Autoscaling.MaxReplicas,
+		TargetCPUUtilizationPercentage: in.Spec.Autoscaling.TargetCPUUtilizationPercentage,
+	}
+	spec.Database = v2.DatabaseSpec{
+		Provider:         in.Spec.Database.Provider,
+		StorageClassName: in.Spec.Database.StorageClassName,
+		Storage:          in.Spec.Database.Storage,
+	}
+	spec.Expose.Type = v2.ExposeType(in.Spec.Expose.Type)
+	spec.Paused = in.Spec.Paused
+	spec.Maintenance = v2.MaintenanceSpec{
+		Enabled: in.Spec.Maintenance.Enabled,
+		Message: in.Spec.Maintenance.Message,
+	}
+	spec.Hibernate.Enabled = in.Spec.Hibernate.Enabled
+	spec.Hibernate.Schedule = nil
+	if s := in.Spec.Hibernate.Schedule; s != nil {
+		spec.Hibernate.Schedule = &v2.HibernateSchedule{Sleep: s.Sleep, Wake: s.Wake}
+	}
+
+	dst.Status.PodStatus = in.Status.PodStatus
+	dst.Status.Conditions = in.Status.Conditions
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v2) to this version. When v1
+// cannot represent the whole object, the v2 spec and status are kept in the
+// conversion data annotation.
+func (dst *Bestie) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v2.Bestie).DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = BestieSpec{
+		Size:       src.Spec.App.Replicas,
+		AgencyName: src.Spec.AgencyName,
+		App: AppSpec{
+			Image:     src.Spec.App.Image,
+			Version:   src.Spec.App.Version,
+			Resources: src.Spec.App.Resources,
+		},
+		Database: DatabaseSpec{
+			Provider:         src.Spec.Database.Provider,
+			StorageClassName: src.Spec.Database.StorageClassName,
+			Storage:          src.Spec.Database.Storage,
+		},
+		Expose: ExposeSpec{Type: ExposeType(src.Spec.Expose.Type)},
+		Autoscaling: AutoscalingSpec{
+			Enabled:                        src.Spec.App.Autoscaling.Enabled,
+			MinReplicas:                    src.Spec.App.Autoscaling.MinReplicas,
+			MaxReplicas:                    src.Spec.App.Autoscaling.MaxReplicas,
+			TargetCPUUtilizationPercentage: src.Spec.App.Autoscaling.TargetCPUUtilizationPercentage,
+		},
+		Paused: src.Spec.Paused,
+		Maintenance: MaintenanceSpec{
+			Enabled: src.Spec.Maintenance.Enabled,
+			Message: src.Spec.Maintenance.Message,
+		},
+		Hibernate: HibernateSpec{Enabled: src.Spec.Hibernate.Enabled},
+	}
+	if s := src.Spec.Hibernate.Schedule; s != nil {
+		dst.Spec.Hibernate.Schedule = &HibernateSchedule{Sleep: s.Sleep, Wake: s.Wake}
+	}
+	dst.Status = BestieStatus{
+		PodStatus:  src.Status.PodStatus,
+		Conditions: src.Status.Conditions,
+	}
+
+	// Only stash the v2 object when converting back would lose something.
+	back := &v2.Bestie{}
+	if err := dst.DeepCopy().ConvertTo(back); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(back.Spec, src.Spec) && equality.Semantic.DeepEqual(back.Status, src.Status) {
+		return nil
+	}
+	raw, err := json.Marshal(conversionData{Spec: src.Spec, Status: src.Status})
+	if err != nil {
+		return err
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[v2.ConversionDataAnnotation] = string(raw)
+	return nil
+}
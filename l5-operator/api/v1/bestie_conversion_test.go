@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	v2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestConvertV1RoundTrip(t *testing.T) {
+	g := NewWithT(t)
+
+	storage := resource.MustParse("5Gi")
+	minReplicas := int32(2)
+	v1Bestie := &Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", Annotations: map[string]string{"team": "pets"}},
+		Spec: BestieSpec{
+			Size:        3,
+			AgencyName:  "Animal Humane Society",
+			App:         AppSpec{Image: "quay.io/mkong/bestiev2", Version: "1.1"},
+			Database:    DatabaseSpec{Provider: DatabaseProviderPGO, Storage: &storage},
+			Expose:      ExposeSpec{Type: ExposeIngress},
+			Autoscaling: AutoscalingSpec{Enabled: true, MinReplicas: &minReplicas, MaxReplicas: 5},
+			Maintenance: MaintenanceSpec{Enabled: true, Message: "Back soon"},
+			Hibernate:   HibernateSpec{Schedule: &HibernateSchedule{Sleep: "0 20 * * *", Wake: "0 8 * * *"}},
+		},
+		Status: BestieStatus{
+			PodStatus:  "Running",
+			Conditions: []metav1.Condition{{Type: ConditionMaintenance, Status: metav1.ConditionTrue, Reason: "MaintenanceEnabled"}},
+		},
+	}
+
+	hub := &v2.Bestie{}
+	g.Expect(v1Bestie.ConvertTo(hub)).To(Succeed())
+	g.Expect(hub.Spec.App.Replicas).To(Equal(int32(3)))
+	g.Expect(hub.Spec.App.Autoscaling.MaxReplicas).To(Equal(int32(5)))
+
+	back := &Bestie{}
+	g.Expect(back.ConvertFrom(hub)).To(Succeed())
+	g.Expect(back).To(Equal(v1Bestie))
+	g.Expect(back.Annotations).NotTo(HaveKey(v2.ConversionDataAnnotation))
+}
+
+func TestConvertV2FieldsSurviveV1(t *testing.T) {
+	g := NewWithT(t)
+
+	hub := &v2.Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets"},
+		Spec: v2.BestieSpec{
+			AgencyName: "Animal Humane Society",
+			App: v2.AppSpec{
+				Replicas: 2,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				},
+			},
+			Backup:     v2.BackupSpec{Schedule: "0 1 * * *"},
+			Monitoring: v2.MonitoringSpec{Enabled: true},
+		},
+	}
+
+	spoke := &Bestie{}
+	g.Expect(spoke.ConvertFrom(hub)).To(Succeed())
+	g.Expect(spoke.Annotations).To(HaveKey(v2.ConversionDataAnnotation))
+
+	// An edit made through v1 wins over the stashed v2 fields.
+	spoke.Spec.Size = 4
+
+	roundTripped := &v2.Bestie{}
+	g.Expect(spoke.ConvertTo(roundTripped)).To(Succeed())
+	g.Expect(roundTripped.Annotations).NotTo(HaveKey(v2.ConversionDataAnnotation))
+	g.Expect(roundTripped.Spec.Backup).To(Equal(hub.Spec.Backup))
+	g.Expect(roundTripped.Spec.Monitoring).To(Equal(hub.Spec.Monitoring))
+	g.Expect(roundTripped.Spec.App.Replicas).To(Equal(int32(4)))
+
+	hub.Spec.App.Replicas = 4
+	g.Expect(roundTripped).To(Equal(hub))
+}
+
+func TestConvertGatewayExposure(t *testing.T) {
+	g := NewWithT(t)
+
+	hub := &v2.Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets"},
+		Spec: v2.BestieSpec{
+			AgencyName: "Animal Humane Society",
+			App:        v2.AppSpec{Replicas: 2},
+			Expose: v2.ExposeSpec{
+				Type:      v2.ExposeGateway,
+				ParentRef: &v2.GatewayParentReference{Name: "public", Namespace: "gateways", SectionName: "https"},
+			},
+		},
+	}
+
+	spoke := &Bestie{}
+	g.Expect(spoke.ConvertFrom(hub)).To(Succeed())
+	g.Expect(spoke.Spec.Expose.Type).To(Equal(ExposeGateway))
+
+	// Pausing through v1, as bestiectl does, keeps the Gateway exposure.
+	spoke.Spec.Paused = true
+
+	roundTripped := &v2.Bestie{}
+	g.Expect(spoke.ConvertTo(roundTripped)).To(Succeed())
+	hub.Spec.Paused = true
+	g.Expect(roundTripped).To(Equal(hub))
+}
+
+// TestExposeTypeEnum checks that the v1 CRD schema accepts every expose
+// type of v2, as objects converted to v1 are validated against it.
+func TestExposeTypeEnum(t *testing.T) {
+	g := NewWithT(t)
+
+	raw, err := os.ReadFile("../../config/crd/bases/pets.bestie.com_besties.yaml")
+	g.Expect(err).NotTo(HaveOccurred())
+	var crd struct {
+		Spec struct {
+			Versions []struct {
+				Name   string `json:"name"`
+				Schema struct {
+					OpenAPIV3Schema struct {
+						Properties struct {
+							Spec struct {
+								Properties struct {
+									Expose struct {
+										Properties struct {
+											Type struct {
+												Enum []string `json:"enum"`
+											} `json:"type"`
+										} `json:"properties"`
+									} `json:"expose"`
+								} `json:"properties"`
+							} `json:"spec"`
+						} `json:"properties"`
+					} `json:"openAPIV3Schema"`
+				} `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}
+	g.Expect(yaml.Unmarshal(raw, &crd)).To(Succeed())
+
+	enums := map[string][]string{}
+	for _, v := range crd.Spec.Versions {
+		enums[v.Name] = v.Schema.OpenAPIV3Schema.Properties.Spec.Properties.Expose.Properties.Type.Enum
+	}
+	g.Expect(enums["v2"]).To(ConsistOf(string(v2.ExposeRoute), string(v2.ExposeIngress), string(v2.ExposeGateway)))
+	g.Expect(enums["v1"]).To(ConsistOf(enums["v2"]))
+}
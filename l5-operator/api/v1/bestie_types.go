@@ -17,29 +17,203 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
-
 // BestieSpec defines the desired state of Bestie
 type BestieSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Size is the number of app replicas.
+	Size int32 `json:"size"`
 
-	// Foo is an example field of Bestie. Edit bestie_types.go to remove/update
-	Size       int32  `json:"size"`
+	// AgencyName is the name of the agency shown by the app.
 	AgencyName string `json:"agencyname"`
+
+	// App configures the bestie app container.
+	// +optional
+	App AppSpec `json:"app,omitempty"`
+
+	// Database configures the Postgres database backing the app.
+	// +optional
+	Database DatabaseSpec `json:"database,omitempty"`
+
+	// Expose configures how the app is reachable from outside the cluster.
+	// +optional
+	Expose ExposeSpec `json:"expose,omitempty"`
+
+	// Autoscaling lets a HorizontalPodAutoscaler scale the app. Size is the
+	// replica count the app starts from and must lie within the bounds.
+	// +optional
+	Autoscaling AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Paused stops the operator from changing any object of this Bestie.
+	// Status is still refreshed. The bestie.com/paused annotation has the same effect.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Maintenance replaces the app with a static maintenance page.
+	// +optional
+	Maintenance MaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Hibernate scales the whole stack to zero, on demand or on a schedule.
+	// +optional
+	Hibernate HibernateSpec `json:"hibernate,omitempty"`
+}
+
+// AppSpec configures the bestie app container.
+type AppSpec struct {
+	// Image is the app container image, without a tag. Defaults to the
+	// operator-wide app image.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Version is the app image tag. Defaults to the operator-wide app version.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Resources are the compute resources of the app container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// ExposeType is the kind of object exposing the app outside the cluster.
+// +kubebuilder:validation:Enum=Route;Ingress;Gateway
+type ExposeType string
+
+const (
+	// ExposeRoute exposes the app through an OpenShift Route.
+	ExposeRoute ExposeType = "Route"
+	// ExposeIngress exposes the app through an Ingress.
+	ExposeIngress ExposeType = "Ingress"
+	// ExposeGateway exposes the app through a Gateway API HTTPRoute. The
+	// Gateway it attaches to is only set through v2.
+	ExposeGateway ExposeType = "Gateway"
+)
+
+// ExposeSpec configures how the app is exposed.
+type ExposeSpec struct {
+	// Type is the kind of object exposing the app. Defaults to Route on
+	// OpenShift and to Ingress elsewhere.
+	// +optional
+	Type ExposeType `json:"type,omitempty"`
+}
+
+// DatabaseSpec configures the Postgres database of a Bestie.
+type DatabaseSpec struct {
+	// Provider is the operator running the database. It cannot be changed
+	// once set.
+	// +kubebuilder:validation:Enum=PGO
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// StorageClassName is the storage class of the database volume. It cannot
+	// be changed once set; the cluster default is used when empty.
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// Storage is the size of the database volume. It can be increased, as far
+	// as the storage class allows volume expansion, but never decreased.
+	// +optional
+	Storage *resource.Quantity `json:"storage,omitempty"`
+}
+
+// AutoscalingSpec configures horizontal autoscaling of the app.
+type AutoscalingSpec struct {
+	// Enabled creates a HorizontalPodAutoscaler for the app Deployment.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// MinReplicas is the lower bound of the app replicas. Defaults to 1.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper bound of the app replicas.
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+
+	// TargetCPUUtilizationPercentage is the average CPU utilization the
+	// autoscaler aims for. Defaults to 80.
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// MaintenanceSpec configures the maintenance mode of a Bestie.
+type MaintenanceSpec struct {
+	// Enabled scales the app to zero and routes traffic to a maintenance page.
+	// Traffic is switched back once the app is ready again after disabling it.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Message is shown on the maintenance page below the agency name.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// HibernateSpec configures when a Bestie is hibernated. While hibernated the
+// app is scaled to zero, the database is shut down and scheduled backups are
+// suspended. On wake-up the database is started first, then the app, which
+// receives traffic once it is ready.
+type HibernateSpec struct {
+	// Enabled hibernates the Bestie until it is unset.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Schedule hibernates the Bestie during a recurring window.
+	// +optional
+	Schedule *HibernateSchedule `json:"schedule,omitempty"`
+}
+
+// HibernateSchedule is a recurring hibernation window. Both schedules use the
+// standard cron syntax and may be prefixed with CRON_TZ=<zone>.
+type HibernateSchedule struct {
+	// Sleep is the cron schedule at which the Bestie is hibernated, e.g. "0 20 * * 1-5".
+	Sleep string `json:"sleep"`
+
+	// Wake is the cron schedule at which the Bestie wakes up, e.g. "0 8 * * 1-5".
+	Wake string `json:"wake"`
 }
 
 // BestieStatus defines the observed state of Bestie
 type BestieStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// PodStatus is Running once an app pod is ready, Pending otherwise.
 	PodStatus string `json:"podstatus"`
+
+	// Conditions represent the latest available observations of the Bestie's state.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+const (
+	// PausedAnnotation pauses reconciliation of a Bestie when set to "true".
+	PausedAnnotation = "bestie.com/paused"
+
+	// RestartedAtAnnotation restarts the app pods whenever its value, by
+	// convention the time of the request, changes.
+	RestartedAtAnnotation = "bestie.com/restartedAt"
+
+	// DatabaseProviderPGO runs the database with the Crunchy Postgres Operator.
+	DatabaseProviderPGO = "PGO"
+
+	// ConditionPaused is true while reconciliation of the Bestie is paused.
+	ConditionPaused = "Paused"
+
+	// ConditionMaintenance is true while traffic is served by the maintenance page.
+	ConditionMaintenance = "Maintenance"
+
+	// ConditionHibernated is true while the Bestie stack is scaled to zero.
+	ConditionHibernated = "Hibernated"
+
+	// ConditionDatabaseReady is true once the database accepts connections
+	// from the app, which is only deployed from then on.
+	ConditionDatabaseReady = "DatabaseReady"
+)
+
+// +genclient
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
@@ -61,6 +235,12 @@ type BestieList struct {
 	Items           []Bestie `json:"items"`
 }
 
+// IsPaused returns whether reconciliation is paused through the spec or the
+// bestie.com/paused annotation.
+func (b *Bestie) IsPaused() bool {
+	return b.Spec.Paused || b.GetAnnotations()[PausedAnnotation] == "true"
+}
+
 func init() {
 	SchemeBuilder.Register(&Bestie{}, &BestieList{})
 }
@@ -0,0 +1,25 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+// ConversionDataAnnotation holds the v2 spec and status of a Bestie served
+// in an older version, so the fields that version cannot represent survive
+// a round trip.
+const ConversionDataAnnotation = "pets.bestie.com/v2-conversion-data"
+
+// Hub marks v2 as the version every other Bestie version converts through.
+func (*Bestie) Hub() {}
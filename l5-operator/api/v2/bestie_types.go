@@ -0,0 +1,781 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BestieSpec defines the desired state of Bestie
+type BestieSpec struct {
+	// AgencyName is the name of the agency shown by the app.
+	AgencyName string `json:"agencyName"`
+
+	// App configures the bestie app.
+	// +optional
+	App AppSpec `json:"app,omitempty"`
+
+	// Database configures the Postgres database backing the app.
+	// +optional
+	Database DatabaseSpec `json:"database,omitempty"`
+
+	// Expose configures how the app is reachable from outside the cluster.
+	// +optional
+	Expose ExposeSpec `json:"expose,omitempty"`
+
+	// Backup configures the backups of the database.
+	// +optional
+	Backup BackupSpec `json:"backup,omitempty"`
+
+	// Monitoring configures the metrics exported by the stack.
+	// +optional
+	Monitoring MonitoringSpec `json:"monitoring,omitempty"`
+
+	// Paused stops the operator from changing any object of this Bestie.
+	// Status is still refreshed. The bestie.com/paused annotation has the same effect.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Maintenance replaces the app with a static maintenance page.
+	// +optional
+	Maintenance MaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Hibernate scales the whole stack to zero, on demand or on a schedule.
+	// +optional
+	Hibernate HibernateSpec `json:"hibernate,omitempty"`
+
+	// Rollout configures how changes of the app are rolled out.
+	// +optional
+	Rollout RolloutSpec `json:"rollout,omitempty"`
+
+	// NetworkPolicy isolates the pods of the Bestie stack.
+	// +optional
+	NetworkPolicy NetworkPolicySpec `json:"networkPolicy,omitempty"`
+}
+
+// AppSpec configures the bestie app.
+type AppSpec struct {
+	// Replicas is the number of app replicas. With autoscaling it is the
+	// replica count the app starts from and must lie within the bounds.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Image is the app container image, without a tag. Defaults to the
+	// operator-wide app image.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Version is the app image tag. Defaults to the operator-wide app version.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Resources are the compute resources of the app container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Autoscaling lets a HorizontalPodAutoscaler scale the app.
+	// +optional
+	Autoscaling AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// PodSecurityContext replaces the security context of the app,
+	// maintenance page and migration Job pods. Defaults to running as a
+	// non-root user with the RuntimeDefault seccomp profile; outside
+	// OpenShift, which assigns the user, as user 1001.
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// SecurityContext replaces the security context of the containers of
+	// those pods. Defaults to dropping all capabilities, no privilege
+	// escalation and a read-only root filesystem, with an emptyDir mounted
+	// at /tmp.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+}
+
+// AutoscalingSpec configures horizontal autoscaling of the app.
+type AutoscalingSpec struct {
+	// Enabled creates a HorizontalPodAutoscaler for the app Deployment.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// MinReplicas is the lower bound of the app replicas. Defaults to 1.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper bound of the app replicas.
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+
+	// TargetCPUUtilizationPercentage is the average CPU utilization the
+	// autoscaler aims for. Defaults to 80.
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// DatabaseSpec configures the Postgres database of a Bestie.
+type DatabaseSpec struct {
+	// Provider is the operator running the database. It cannot be changed
+	// once set.
+	// +kubebuilder:validation:Enum=PGO
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// StorageClassName is the storage class of the database volume. It cannot
+	// be changed after creation; the cluster default is used when empty.
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// Storage is the size of the database volume. It can be increased, as far
+	// as the storage class allows volume expansion, but never decreased.
+	// +optional
+	Storage *resource.Quantity `json:"storage,omitempty"`
+
+	// CredentialRotation rotates the password of the database user on a
+	// schedule, or whenever the bestie.com/rotateCredentials annotation
+	// changes.
+	// +optional
+	CredentialRotation *CredentialRotationSpec `json:"credentialRotation,omitempty"`
+}
+
+// CredentialRotationSpec configures the rotation of the password of the
+// database user. PGO generates the new password; the app and the running
+// Jobs are restarted once it is in the user Secret.
+type CredentialRotationSpec struct {
+	// Schedule is the cron schedule of the rotations. Without it the
+	// password is only rotated through the annotation.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// ExposeType is the kind of object exposing the app outside the cluster.
+// +kubebuilder:validation:Enum=Route;Ingress;Gateway
+type ExposeType string
+
+const (
+	// ExposeRoute exposes the app through an OpenShift Route.
+	ExposeRoute ExposeType = "Route"
+	// ExposeIngress exposes the app through an Ingress.
+	ExposeIngress ExposeType = "Ingress"
+	// ExposeGateway exposes the app through a Gateway API HTTPRoute
+	// attached to the Gateway of spec.expose.parentRef.
+	ExposeGateway ExposeType = "Gateway"
+)
+
+// ExposeSpec configures how the app is exposed.
+type ExposeSpec struct {
+	// Type is the kind of object exposing the app. Defaults to Route on
+	// OpenShift and to Ingress elsewhere.
+	// +optional
+	Type ExposeType `json:"type,omitempty"`
+
+	// Host is the host name the app is served at. Routes get a host
+	// generated by the router and Ingresses match any host when it is empty.
+	// Certificates issued by cert-manager need it.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// TLS serves the app over HTTPS. It cannot be set with the Gateway type,
+	// where TLS ends at the Gateway listener, which must refer to the Secret
+	// of the certificate itself.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// ParentRef is the Gateway the HTTPRoute of the Gateway type attaches to.
+	// +optional
+	ParentRef *GatewayParentReference `json:"parentRef,omitempty"`
+
+	// Service configures the bestie Service the Route, Ingress or HTTPRoute
+	// points at.
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+}
+
+// ServiceSpec configures the bestie Service.
+type ServiceSpec struct {
+	// Type is the type of the Service. Defaults to ClusterIP, as the app is
+	// reachable through the Route, Ingress or HTTPRoute.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Port is the port of the Service. Defaults to 443 when TLS is
+	// reencrypted and to 80 otherwise.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Annotations are added to the Service, e.g. to configure the load
+	// balancer of the cloud provider.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// LoadBalancerSourceRanges restricts the clients of a LoadBalancer
+	// Service to these CIDRs.
+	// +optional
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+}
+
+// EffectiveType returns the type of the Service, ClusterIP when unset.
+func (s ServiceSpec) EffectiveType() corev1.ServiceType {
+	if s.Type == "" {
+		return corev1.ServiceTypeClusterIP
+	}
+	return s.Type
+}
+
+// GatewayParentReference refers to a Gateway, or to one of its listeners.
+type GatewayParentReference struct {
+	// Name is the name of the Gateway.
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Gateway. Defaults to the namespace
+	// of the Bestie.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the name of the listener to attach to. The HTTPRoute
+	// attaches to every listener that allows it when empty.
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// TLSTermination is where the HTTPS connections of clients end.
+// +kubebuilder:validation:Enum=edge;reencrypt
+type TLSTermination string
+
+const (
+	// TLSTerminationEdge ends TLS at the router, which talks plain HTTP to
+	// the app.
+	TLSTerminationEdge TLSTermination = "edge"
+	// TLSTerminationReencrypt ends TLS at the router, which opens a new TLS
+	// connection to the app. The app then serves a certificate for its
+	// Service, from the OpenShift service CA or, elsewhere, from the
+	// cert-manager issuer of spec.expose.tls.certificate.
+	TLSTerminationReencrypt TLSTermination = "reencrypt"
+)
+
+// CertificateSource is where the certificate served to clients comes from.
+// +kubebuilder:validation:Enum=Secret;CertManager;Router
+type CertificateSource string
+
+const (
+	// CertificateFromSecret serves the certificate of a kubernetes.io/tls Secret.
+	CertificateFromSecret CertificateSource = "Secret"
+	// CertificateFromCertManager serves a certificate cert-manager issues
+	// for spec.expose.host.
+	CertificateFromCertManager CertificateSource = "CertManager"
+	// CertificateFromRouter serves the default certificate of the router,
+	// or of the ingress controller.
+	CertificateFromRouter CertificateSource = "Router"
+)
+
+// TLSSpec configures HTTPS for the app.
+type TLSSpec struct {
+	// Termination is where TLS ends. Defaults to edge.
+	// +optional
+	Termination TLSTermination `json:"termination,omitempty"`
+
+	// Certificate selects the certificate served to clients.
+	// +optional
+	Certificate CertificateSpec `json:"certificate,omitempty"`
+}
+
+// CertificateSpec selects the certificate served to clients.
+type CertificateSpec struct {
+	// Source is where the certificate comes from. Defaults to Secret when
+	// secretName is set, to CertManager when issuerRef is set and to Router
+	// otherwise.
+	// +optional
+	Source CertificateSource `json:"source,omitempty"`
+
+	// SecretName is the kubernetes.io/tls Secret holding the certificate, in
+	// the namespace of the Bestie. Routes embed a copy of it, which is
+	// refreshed on every reconcile, or as soon as the Secret changes when it
+	// carries the app.kubernetes.io/managed-by=l5-operator and
+	// app.kubernetes.io/instance=<bestie name> labels.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// IssuerRef is the cert-manager issuer signing the certificate.
+	// +optional
+	IssuerRef *IssuerReference `json:"issuerRef,omitempty"`
+}
+
+// DefaultSource returns the source of a certificate that does not set one.
+func (c CertificateSpec) DefaultSource() CertificateSource {
+	switch {
+	case c.SecretName != "":
+		return CertificateFromSecret
+	case c.IssuerRef != nil:
+		return CertificateFromCertManager
+	}
+	return CertificateFromRouter
+}
+
+// EffectiveSource returns the source of the certificate, defaulted if unset.
+func (c CertificateSpec) EffectiveSource() CertificateSource {
+	if c.Source != "" {
+		return c.Source
+	}
+	return c.DefaultSource()
+}
+
+// IssuerReference refers to a cert-manager Issuer or ClusterIssuer.
+type IssuerReference struct {
+	// Name is the name of the issuer.
+	Name string `json:"name"`
+
+	// Kind is Issuer, in the namespace of the Bestie, or ClusterIssuer.
+	// Defaults to Issuer.
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// BackupSpec configures the pgBackRest backups of the database.
+type BackupSpec struct {
+	// Schedule is the cron schedule of full backups. Defaults to the
+	// operator-wide backup schedule.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// MonitoringSpec configures the metrics exported by the stack.
+type MonitoringSpec struct {
+	// Enabled runs the Postgres metrics exporter next to the database.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// NetworkPolicySpec configures the NetworkPolicies of a Bestie. The
+// database then only accepts connections from the app and the migration
+// Job, and the app only from the router or ingress controller and from
+// monitoring, or from anywhere with a NodePort or LoadBalancer Service.
+type NetworkPolicySpec struct {
+	// Enabled creates the NetworkPolicies.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// IngressNamespaceSelector selects the namespaces of the router, ingress
+	// controller or Gateway the app is reached through. Defaults to the
+	// ingress policy group on OpenShift and to the ingress-nginx namespace
+	// elsewhere.
+	// +optional
+	IngressNamespaceSelector *metav1.LabelSelector `json:"ingressNamespaceSelector,omitempty"`
+
+	// MonitoringNamespaceSelector selects the namespaces of the Prometheus
+	// scraping the app and the database. Defaults to the monitoring policy
+	// group on OpenShift and to the monitoring namespace elsewhere.
+	// +optional
+	MonitoringNamespaceSelector *metav1.LabelSelector `json:"monitoringNamespaceSelector,omitempty"`
+
+	// Egress restricts the connections the app and the migration Job open.
+	// +optional
+	Egress *EgressPolicySpec `json:"egress,omitempty"`
+}
+
+// EgressPolicySpec restricts the egress of the app and the migration Job to
+// the database, DNS and the given networks.
+type EgressPolicySpec struct {
+	// Enabled creates the egress NetworkPolicy.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// AllowedCIDRs are further networks the app may connect to, e.g. those
+	// of the APIs it calls.
+	// +optional
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+}
+
+// MaintenanceSpec configures the maintenance mode of a Bestie.
+type MaintenanceSpec struct {
+	// Enabled scales the app to zero and routes traffic to a maintenance page.
+	// Traffic is switched back once the app is ready again after disabling it.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Message is shown on the maintenance page below the agency name.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// HibernateSpec configures when a Bestie is hibernated. While hibernated the
+// app is scaled to zero, the database is shut down and scheduled backups are
+// suspended. On wake-up the database is started first, then the app, which
+// receives traffic once it is ready.
+type HibernateSpec struct {
+	// Enabled hibernates the Bestie until it is unset.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Schedule hibernates the Bestie during a recurring window.
+	// +optional
+	Schedule *HibernateSchedule `json:"schedule,omitempty"`
+}
+
+// HibernateSchedule is a recurring hibernation window. Both schedules use the
+// standard cron syntax and may be prefixed with CRON_TZ=<zone>.
+type HibernateSchedule struct {
+	// Sleep is the cron schedule at which the Bestie is hibernated, e.g. "0 20 * * 1-5".
+	Sleep string `json:"sleep"`
+
+	// Wake is the cron schedule at which the Bestie wakes up, e.g. "0 8 * * 1-5".
+	Wake string `json:"wake"`
+}
+
+// RolloutStrategy is how changes of the app are rolled out.
+// +kubebuilder:validation:Enum=RollingUpdate;Canary;BlueGreen
+type RolloutStrategy string
+
+const (
+	// RolloutRollingUpdate updates the app Deployment in place.
+	RolloutRollingUpdate RolloutStrategy = "RollingUpdate"
+	// RolloutCanary runs the new version next to the current one and shifts
+	// traffic to it step by step.
+	RolloutCanary RolloutStrategy = "Canary"
+	// RolloutBlueGreen runs the new version at full scale next to the
+	// current one and switches all traffic to it at once.
+	RolloutBlueGreen RolloutStrategy = "BlueGreen"
+)
+
+// RolloutSpec configures how changes of the app are rolled out. The Canary
+// and BlueGreen strategies split traffic through the weighted backends of the
+// Route or HTTPRoute, so they need the Route or Gateway expose type. While in
+// maintenance or hibernating, the app is always updated in place.
+type RolloutSpec struct {
+	// Strategy is how changes of the app are rolled out. Defaults to
+	// RollingUpdate.
+	// +optional
+	Strategy RolloutStrategy `json:"strategy,omitempty"`
+
+	// Steps are the percentages of traffic the Canary strategy sends to the
+	// new version in turn, before it is promoted. Defaults to 10, 25 and 50.
+	// +optional
+	Steps []int32 `json:"steps,omitempty"`
+
+	// StepDuration is how long each step, and for BlueGreen the switched
+	// traffic, is observed before moving on. Defaults to 1m.
+	// +optional
+	StepDuration *metav1.Duration `json:"stepDuration,omitempty"`
+
+	// MaxRestarts is the number of container restarts of the new version
+	// above which the rollout is aborted.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRestarts int32 `json:"maxRestarts,omitempty"`
+
+	// Analysis compares the metrics of the new and the current version at
+	// the end of each step, and aborts the rollout when the new version does
+	// worse. Without metrics of the new version, e.g. while it gets no
+	// traffic, or while the metrics API fails, the analysis is retried for
+	// one more interval, then the rollout is aborted.
+	// +optional
+	Analysis *AnalysisSpec `json:"analysis,omitempty"`
+}
+
+// AnalysisSpec configures the analysis of a rollout against the request
+// metrics in Prometheus. The queries are Go templates of .Namespace,
+// .Service and .Interval, run for the Services of both versions; their
+// defaults use the metrics of the OpenShift router.
+type AnalysisSpec struct {
+	// Address is the base URL of the Prometheus-compatible HTTP API, e.g.
+	// http://prometheus-operated.monitoring.svc:9090.
+	Address string `json:"address"`
+
+	// BearerTokenSecretRef selects the key of a Secret holding the bearer
+	// token the queries are authenticated with.
+	// +optional
+	BearerTokenSecretRef *corev1.SecretKeySelector `json:"bearerTokenSecretRef,omitempty"`
+
+	// Interval is the window the metrics are computed over. Defaults to the
+	// step duration.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// MaxErrorRateIncrease is how many percentage points the error rate of
+	// the new version may exceed that of the current version by. Defaults
+	// to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxErrorRateIncrease *int32 `json:"maxErrorRateIncrease,omitempty"`
+
+	// MaxLatencyIncrease is how many percent the latency of the new version
+	// may exceed that of the current version by. Defaults to 20.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxLatencyIncrease *int32 `json:"maxLatencyIncrease,omitempty"`
+
+	// ErrorRateQuery returns the ratio of the requests to a Service that
+	// failed, between 0 and 1.
+	// +optional
+	ErrorRateQuery string `json:"errorRateQuery,omitempty"`
+
+	// LatencyQuery returns the response time of a Service in seconds.
+	// +optional
+	LatencyQuery string `json:"latencyQuery,omitempty"`
+}
+
+// EffectiveInterval returns the window the metrics are computed over.
+func (a AnalysisSpec) EffectiveInterval(stepDuration time.Duration) time.Duration {
+	if a.Interval == nil {
+		return stepDuration
+	}
+	return a.Interval.Duration
+}
+
+// EffectiveErrorRateQuery returns the query of the error rate of a Service.
+func (a AnalysisSpec) EffectiveErrorRateQuery() string {
+	if a.ErrorRateQuery == "" {
+		return DefaultErrorRateQuery
+	}
+	return a.ErrorRateQuery
+}
+
+// EffectiveLatencyQuery returns the query of the latency of a Service.
+func (a AnalysisSpec) EffectiveLatencyQuery() string {
+	if a.LatencyQuery == "" {
+		return DefaultLatencyQuery
+	}
+	return a.LatencyQuery
+}
+
+// Progressive returns whether the strategy runs the new version next to the
+// current one rather than updating it in place.
+func (s RolloutSpec) Progressive() bool {
+	return s.Strategy == RolloutCanary || s.Strategy == RolloutBlueGreen
+}
+
+// EffectiveSteps returns the percentages of traffic sent to the new version
+// in turn, ending with all of it.
+func (s RolloutSpec) EffectiveSteps() []int32 {
+	if s.Strategy == RolloutBlueGreen {
+		return []int32{100}
+	}
+	steps := s.Steps
+	if len(steps) == 0 {
+		steps = DefaultCanarySteps
+	}
+	return append(append([]int32{}, steps...), 100)
+}
+
+// EffectiveStepDuration returns how long each step is observed.
+func (s RolloutSpec) EffectiveStepDuration() time.Duration {
+	if s.StepDuration == nil {
+		return DefaultStepDuration
+	}
+	return s.StepDuration.Duration
+}
+
+// BestieStatus defines the observed state of Bestie
+type BestieStatus struct {
+	// PodStatus is Running once an app pod is ready, Pending otherwise.
+	// +optional
+	PodStatus string `json:"podStatus,omitempty"`
+
+	// URL is where the app is reachable from outside the cluster, with an
+	// https scheme when TLS is enabled. It is the admitted Route host, the
+	// Ingress or HTTPRoute host or load balancer address, or else the external
+	// address of the bestie Service.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// ExposureType is what URL was taken from: Route, Ingress, Gateway, or
+	// LoadBalancer for the external address of the bestie Service.
+	// +optional
+	ExposureType string `json:"exposureType,omitempty"`
+
+	// InternalServiceURL is where the app is reachable from inside the
+	// cluster, through the bestie Service.
+	// +optional
+	InternalServiceURL string `json:"internalServiceURL,omitempty"`
+
+	// Rollout reports the rollout of the app with the Canary and BlueGreen
+	// strategies.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// Database reports the database of the Bestie.
+	// +optional
+	Database *DatabaseStatus `json:"database,omitempty"`
+
+	// Conditions represent the latest available observations of the Bestie's state.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// DatabaseStatus reports the database of the Bestie.
+type DatabaseStatus struct {
+	// CredentialsRotatedAt is when the password of the database user was
+	// last rotated.
+	// +optional
+	CredentialsRotatedAt *metav1.Time `json:"credentialsRotatedAt,omitempty"`
+}
+
+// RolloutPhase is the state of the rollout of the app.
+type RolloutPhase string
+
+const (
+	// RolloutStable is the phase while all traffic goes to the app and no
+	// new version is rolled out.
+	RolloutStable RolloutPhase = "Stable"
+	// RolloutProgressing is the phase while traffic is shifted to the new
+	// version.
+	RolloutProgressing RolloutPhase = "Progressing"
+	// RolloutPromoting is the phase while the app is updated to the new
+	// version, which meanwhile serves all traffic.
+	RolloutPromoting RolloutPhase = "Promoting"
+	// RolloutAborted is the phase once the new version failed its checks. It
+	// is not rolled out again until the app spec changes.
+	RolloutAborted RolloutPhase = "Aborted"
+)
+
+// RolloutStatus reports the rollout of the app.
+type RolloutStatus struct {
+	// Phase is the state of the rollout.
+	Phase RolloutPhase `json:"phase"`
+
+	// Image is the app image being rolled out.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Step is the index of the current step in spec.rollout.steps.
+	// +optional
+	Step int32 `json:"step,omitempty"`
+
+	// StableWeight and CanaryWeight are the percentages of traffic sent to
+	// the current and to the new version.
+	StableWeight int32 `json:"stableWeight"`
+	CanaryWeight int32 `json:"canaryWeight"`
+
+	// Message explains the phase, e.g. why the rollout was aborted.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	// DefaultCanarySteps are the percentages of traffic the Canary strategy
+	// sends to the new version in turn.
+	DefaultCanarySteps = []int32{10, 25, 50}
+)
+
+const (
+	// DefaultStepDuration is how long each rollout step is observed.
+	DefaultStepDuration = time.Minute
+
+	// DefaultMaxErrorRateIncrease and DefaultMaxLatencyIncrease are the
+	// thresholds of the rollout analysis.
+	DefaultMaxErrorRateIncrease = int32(1)
+	DefaultMaxLatencyIncrease   = int32(20)
+
+	// DefaultErrorRateQuery is the share of 5xx responses the OpenShift
+	// router got from a Service.
+	DefaultErrorRateQuery = `sum(rate(haproxy_server_http_responses_total{namespace="{{ .Namespace }}",service="{{ .Service }}",code="5xx"}[{{ .Interval }}]))` +
+		` / sum(rate(haproxy_server_http_responses_total{namespace="{{ .Namespace }}",service="{{ .Service }}"}[{{ .Interval }}]))`
+
+	// DefaultLatencyQuery is the average response time of a Service as seen
+	// by the OpenShift router.
+	DefaultLatencyQuery = `avg(avg_over_time(haproxy_server_http_average_response_latency_milliseconds{namespace="{{ .Namespace }}",service="{{ .Service }}"}[{{ .Interval }}])) / 1000`
+
+	// PausedAnnotation pauses reconciliation of a Bestie when set to "true".
+	PausedAnnotation = "bestie.com/paused"
+
+	// RestartedAtAnnotation restarts the app pods whenever its value, by
+	// convention the time of the request, changes.
+	RestartedAtAnnotation = "bestie.com/restartedAt"
+
+	// RotateCredentialsAnnotation rotates the password of the database user
+	// whenever its value changes, with spec.database.credentialRotation set.
+	RotateCredentialsAnnotation = "bestie.com/rotateCredentials"
+
+	// DefaultMinReplicas is the lower bound of the app replicas when autoscaling.
+	DefaultMinReplicas = int32(1)
+
+	// DefaultTargetCPUUtilizationPercentage is the CPU utilization the app
+	// autoscaler aims for.
+	DefaultTargetCPUUtilizationPercentage = int32(80)
+
+	// DatabaseProviderPGO runs the database with the Crunchy Postgres Operator.
+	DatabaseProviderPGO = "PGO"
+
+	// IssuerKind and ClusterIssuerKind are the kinds of cert-manager issuers.
+	IssuerKind        = "Issuer"
+	ClusterIssuerKind = "ClusterIssuer"
+
+	// ExposureLoadBalancer is the exposure type of a URL taken from the
+	// external address of the bestie Service.
+	ExposureLoadBalancer = "LoadBalancer"
+
+	// ConditionPaused is true while reconciliation of the Bestie is paused.
+	ConditionPaused = "Paused"
+
+	// ConditionMaintenance is true while traffic is served by the maintenance page.
+	ConditionMaintenance = "Maintenance"
+
+	// ConditionHibernated is true while the Bestie stack is scaled to zero.
+	ConditionHibernated = "Hibernated"
+
+	// ConditionDatabaseReady is true once the database accepts connections
+	// from the app, which is only deployed from then on.
+	ConditionDatabaseReady = "DatabaseReady"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.podStatus`
+//+kubebuilder:printcolumn:name="Exposure",type=string,JSONPath=`.status.exposureType`
+//+kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+//+kubebuilder:printcolumn:name="Internal URL",type=string,JSONPath=`.status.internalServiceURL`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Bestie is the Schema for the besties API
+type Bestie struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BestieSpec   `json:"spec,omitempty"`
+	Status BestieStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BestieList contains a list of Bestie
+type BestieList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Bestie `json:"items"`
+}
+
+// IsPaused returns whether reconciliation is paused through the spec or the
+// bestie.com/paused annotation.
+func (b *Bestie) IsPaused() bool {
+	return b.Spec.Paused || b.GetAnnotations()[PausedAnnotation] == "true"
+}
+
+func init() {
+	SchemeBuilder.Register(&Bestie{}, &BestieList{})
+}
@@ -0,0 +1,411 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var bestielog = logf.Log.WithName("bestie-resource")
+
+// WebhookDefaults are the operator-wide values the defaulting webhook fills
+// into every Bestie, so the stored object shows the effective settings.
+type WebhookDefaults struct {
+	AppImage        string
+	AppVersion      string
+	AppResources    corev1.ResourceRequirements
+	DatabaseStorage resource.Quantity
+	BackupSchedule  string
+	// ExposeType depends on the platform the operator runs on.
+	ExposeType ExposeType
+}
+
+// webhookDefaults is set once by SetupWebhookWithManager, as the Defaulter
+// interface leaves no other way to hand them to Default.
+var webhookDefaults WebhookDefaults
+
+// SetupWebhookWithManager registers the Bestie webhooks with the manager.
+func (r *Bestie) SetupWebhookWithManager(mgr ctrl.Manager, defaults WebhookDefaults) error {
+	webhookDefaults = defaults
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-pets-bestie-com-v2-bestie,mutating=true,failurePolicy=fail,sideEffects=None,groups=pets.bestie.com,resources=besties,verbs=create;update,versions=v2,name=mbestie.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Bestie{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Bestie) Default() {
+	bestielog.Info("default", "name", r.Name)
+
+	r.SetDefaults(webhookDefaults)
+}
+
+// SetDefaults fills every field left empty with the given defaults.
+func (r *Bestie) SetDefaults(d WebhookDefaults) {
+	app := &r.Spec.App
+	if app.Image == "" {
+		app.Image = d.AppImage
+	}
+	if app.Version == "" {
+		app.Version = d.AppVersion
+	}
+	if app.Resources.Requests == nil && app.Resources.Limits == nil {
+		d.AppResources.DeepCopyInto(&app.Resources)
+	}
+
+	db := &r.Spec.Database
+	if db.Provider == "" {
+		db.Provider = DatabaseProviderPGO
+	}
+	if db.Storage == nil && !d.DatabaseStorage.IsZero() {
+		storage := d.DatabaseStorage.DeepCopy()
+		db.Storage = &storage
+	}
+
+	if r.Spec.Backup.Schedule == "" {
+		r.Spec.Backup.Schedule = d.BackupSchedule
+	}
+
+	if r.Spec.Expose.Type == "" {
+		r.Spec.Expose.Type = d.ExposeType
+	}
+	if tls := r.Spec.Expose.TLS; tls != nil {
+		if tls.Termination == "" {
+			tls.Termination = TLSTerminationEdge
+		}
+		if cert := &tls.Certificate; cert.Source == "" {
+			cert.Source = cert.DefaultSource()
+		}
+		if ref := tls.Certificate.IssuerRef; ref != nil && ref.Kind == "" {
+			ref.Kind = IssuerKind
+		}
+	}
+	if svc := &r.Spec.Expose.Service; svc.Type == "" {
+		svc.Type = svc.EffectiveType()
+	}
+
+	rollout := &r.Spec.Rollout
+	if rollout.Strategy == "" {
+		rollout.Strategy = RolloutRollingUpdate
+	}
+	if rollout.Progressive() {
+		if rollout.Strategy == RolloutCanary && len(rollout.Steps) == 0 {
+			rollout.Steps = append([]int32{}, DefaultCanarySteps...)
+		}
+		if rollout.StepDuration == nil {
+			rollout.StepDuration = &metav1.Duration{Duration: DefaultStepDuration}
+		}
+	}
+	if analysis := rollout.Analysis; analysis != nil {
+		if analysis.MaxErrorRateIncrease == nil {
+			maxErrorRateIncrease := DefaultMaxErrorRateIncrease
+			analysis.MaxErrorRateIncrease = &maxErrorRateIncrease
+		}
+		if analysis.MaxLatencyIncrease == nil {
+			maxLatencyIncrease := DefaultMaxLatencyIncrease
+			analysis.MaxLatencyIncrease = &maxLatencyIncrease
+		}
+	}
+
+	if as := &r.Spec.App.Autoscaling; as.Enabled {
+		if as.MinReplicas == nil {
+			minReplicas := DefaultMinReplicas
+			as.MinReplicas = &minReplicas
+		}
+		if as.TargetCPUUtilizationPercentage == nil {
+			target := DefaultTargetCPUUtilizationPercentage
+			as.TargetCPUUtilizationPercentage = &target
+		}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-pets-bestie-com-v2-bestie,mutating=false,failurePolicy=fail,sideEffects=None,groups=pets.bestie.com,resources=besties,verbs=create;update,versions=v2,name=vbestie.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Bestie{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Bestie) ValidateCreate() error {
+	bestielog.Info("validate create", "name", r.Name)
+
+	return r.toInvalid(r.validateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Bestie) ValidateUpdate(old runtime.Object) error {
+	bestielog.Info("validate update", "name", r.Name)
+
+	oldBestie, ok := old.(*Bestie)
+	if !ok {
+		return apierrors.NewBadRequest("expected a Bestie")
+	}
+
+	allErrs := r.validateSpec()
+	allErrs = append(allErrs, r.validateSpecUpdate(oldBestie)...)
+	return r.toInvalid(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Bestie) ValidateDelete() error {
+	return nil
+}
+
+// validateSpec checks the field ranges and the rules spanning several fields.
+func (r *Bestie) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	appPath := specPath.Child("app")
+	if r.Spec.App.Replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(appPath.Child("replicas"), r.Spec.App.Replicas, "must be greater than or equal to 0"))
+	}
+	if strings.TrimSpace(r.Spec.AgencyName) == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("agencyName"), "must not be empty"))
+	}
+
+	dbPath := specPath.Child("database")
+	if p := r.Spec.Database.Provider; p != "" && p != DatabaseProviderPGO {
+		allErrs = append(allErrs, field.NotSupported(dbPath.Child("provider"), p, []string{DatabaseProviderPGO}))
+	}
+	if s := r.Spec.Database.Storage; s != nil && s.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(dbPath.Child("storage"), s.String(), "must be greater than 0"))
+	}
+
+	allErrs = append(allErrs, r.validateAutoscaling(appPath)...)
+	allErrs = append(allErrs, r.validateTLS(specPath.Child("expose"))...)
+	allErrs = append(allErrs, r.validateService(specPath.Child("expose", "service"))...)
+	allErrs = append(allErrs, r.validateRollout(specPath.Child("rollout"))...)
+	if r.Spec.Expose.Type == ExposeGateway {
+		if ref := r.Spec.Expose.ParentRef; ref == nil || ref.Name == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("expose", "parentRef", "name"), "is required for the Gateway type"))
+		}
+	}
+
+	if schedule := r.Spec.Backup.Schedule; schedule != "" {
+		if _, err := cron.ParseStandard(schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("backup", "schedule"), schedule, err.Error()))
+		}
+	}
+
+	policyPath := specPath.Child("networkPolicy")
+	if s := r.Spec.NetworkPolicy.IngressNamespaceSelector; s != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(s, policyPath.Child("ingressNamespaceSelector"))...)
+	}
+	if s := r.Spec.NetworkPolicy.MonitoringNamespaceSelector; s != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(s, policyPath.Child("monitoringNamespaceSelector"))...)
+	}
+	if egress := r.Spec.NetworkPolicy.Egress; egress != nil {
+		for i, cidr := range egress.AllowedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				allErrs = append(allErrs, field.Invalid(policyPath.Child("egress", "allowedCIDRs").Index(i), cidr, "must be a CIDR"))
+			}
+		}
+	}
+
+	if rotation := r.Spec.Database.CredentialRotation; rotation != nil && rotation.Schedule != "" {
+		if _, err := cron.ParseStandard(rotation.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(dbPath.Child("credentialRotation", "schedule"), rotation.Schedule, err.Error()))
+		}
+	}
+
+	if schedule := r.Spec.Hibernate.Schedule; schedule != nil {
+		schedulePath := specPath.Child("hibernate", "schedule")
+		if _, err := cron.ParseStandard(schedule.Sleep); err != nil {
+			allErrs = append(allErrs, field.Invalid(schedulePath.Child("sleep"), schedule.Sleep, err.Error()))
+		}
+		if _, err := cron.ParseStandard(schedule.Wake); err != nil {
+			allErrs = append(allErrs, field.Invalid(schedulePath.Child("wake"), schedule.Wake, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// validateAutoscaling checks the autoscaling bounds, and that the replicas the
+// app starts from lie within them.
+func (r *Bestie) validateAutoscaling(appPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	path := appPath.Child("autoscaling")
+	as := r.Spec.App.Autoscaling
+	if !as.Enabled {
+		return allErrs
+	}
+
+	minReplicas := DefaultMinReplicas
+	if as.MinReplicas != nil {
+		minReplicas = *as.MinReplicas
+		if minReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(path.Child("minReplicas"), minReplicas, "must be greater than or equal to 1"))
+		}
+	}
+	if as.MaxReplicas < minReplicas {
+		allErrs = append(allErrs, field.Invalid(path.Child("maxReplicas"), as.MaxReplicas, "must be greater than or equal to minReplicas"))
+	}
+	if t := as.TargetCPUUtilizationPercentage; t != nil && (*t < 1 || *t > 100) {
+		allErrs = append(allErrs, field.Invalid(path.Child("targetCPUUtilizationPercentage"), *t, "must be between 1 and 100"))
+	}
+	if replicas := r.Spec.App.Replicas; replicas < minReplicas || replicas > as.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(appPath.Child("replicas"), replicas, "must be between autoscaling minReplicas and maxReplicas"))
+	}
+
+	return allErrs
+}
+
+// validateTLS checks that the certificate source has what it needs.
+func (r *Bestie) validateTLS(exposePath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	tls := r.Spec.Expose.TLS
+	if tls == nil {
+		return allErrs
+	}
+	if r.Spec.Expose.Type == ExposeGateway {
+		// The operator does not manage the Gateway, so it cannot serve the
+		// certificate.
+		return append(allErrs, field.Forbidden(exposePath.Child("tls"),
+			"is not supported with the Gateway type: configure TLS on the Gateway listener"))
+	}
+	certPath := exposePath.Child("tls", "certificate")
+	cert := tls.Certificate
+	switch cert.EffectiveSource() {
+	case CertificateFromSecret:
+		if cert.SecretName == "" {
+			allErrs = append(allErrs, field.Required(certPath.Child("secretName"), "is required for the Secret source"))
+		}
+	case CertificateFromCertManager:
+		if cert.IssuerRef == nil || cert.IssuerRef.Name == "" {
+			allErrs = append(allErrs, field.Required(certPath.Child("issuerRef", "name"), "is required for the CertManager source"))
+		}
+		if r.Spec.Expose.Host == "" {
+			allErrs = append(allErrs, field.Required(exposePath.Child("host"), "is required for the CertManager source"))
+		}
+	}
+	return allErrs
+}
+
+// validateService checks the annotations and the load balancer source ranges
+// of the Service.
+func (r *Bestie) validateService(path *field.Path) field.ErrorList {
+	svc := r.Spec.Expose.Service
+	allErrs := apivalidation.ValidateAnnotations(svc.Annotations, path.Child("annotations"))
+	rangesPath := path.Child("loadBalancerSourceRanges")
+	if len(svc.LoadBalancerSourceRanges) > 0 && svc.EffectiveType() != corev1.ServiceTypeLoadBalancer {
+		allErrs = append(allErrs, field.Forbidden(rangesPath, "may only be set for the LoadBalancer type"))
+	}
+	for i, cidr := range svc.LoadBalancerSourceRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			allErrs = append(allErrs, field.Invalid(rangesPath.Index(i), cidr, "must be a CIDR such as 192.0.2.0/24"))
+		}
+	}
+	return allErrs
+}
+
+// validateRollout checks that the Canary and BlueGreen strategies can split
+// traffic and that the canary steps increase.
+func (r *Bestie) validateRollout(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	rollout := r.Spec.Rollout
+	if !rollout.Progressive() {
+		return allErrs
+	}
+	if t := r.Spec.Expose.Type; t != ExposeRoute && t != ExposeGateway {
+		allErrs = append(allErrs, field.Forbidden(path.Child("strategy"),
+			"the "+string(rollout.Strategy)+" strategy needs the Route or Gateway expose type"))
+	}
+	if tls := r.Spec.Expose.TLS; tls != nil && tls.Termination == TLSTerminationReencrypt {
+		// The serving certificate only covers the Service of the current version.
+		allErrs = append(allErrs, field.Forbidden(path.Child("strategy"),
+			"the "+string(rollout.Strategy)+" strategy does not support reencrypt TLS termination"))
+	}
+	previous := int32(0)
+	for i, step := range rollout.Steps {
+		if step <= previous || step >= 100 {
+			allErrs = append(allErrs, field.Invalid(path.Child("steps").Index(i), step, "must be greater than the previous step and less than 100"))
+		}
+		previous = step
+	}
+	if d := rollout.StepDuration; d != nil && d.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("stepDuration"), d.Duration.String(), "must be positive"))
+	}
+
+	if analysis := rollout.Analysis; analysis != nil {
+		analysisPath := path.Child("analysis")
+		if u, err := url.Parse(analysis.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(analysisPath.Child("address"), analysis.Address, "must be an http or https URL"))
+		}
+		if d := analysis.Interval; d != nil && d.Duration < time.Second {
+			allErrs = append(allErrs, field.Invalid(analysisPath.Child("interval"), d.Duration.String(), "must be at least 1s"))
+		}
+		for name, query := range map[string]string{"errorRateQuery": analysis.ErrorRateQuery, "latencyQuery": analysis.LatencyQuery} {
+			if _, err := template.New(name).Option("missingkey=error").Parse(query); err != nil {
+				allErrs = append(allErrs, field.Invalid(analysisPath.Child(name), query, err.Error()))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateSpecUpdate rejects changes the database cannot follow: moving it to
+// another provider or storage class, or shrinking its volume.
+func (r *Bestie) validateSpecUpdate(old *Bestie) field.ErrorList {
+	var allErrs field.ErrorList
+	dbPath := field.NewPath("spec", "database")
+	oldDB, newDB := old.Spec.Database, r.Spec.Database
+
+	if oldDB.Provider != "" && newDB.Provider != oldDB.Provider {
+		allErrs = append(allErrs, field.Forbidden(dbPath.Child("provider"), "field is immutable"))
+	}
+	if newDB.StorageClassName != oldDB.StorageClassName {
+		allErrs = append(allErrs, field.Forbidden(dbPath.Child("storageClassName"), "field is immutable"))
+	}
+	if oldDB.Storage != nil {
+		if newDB.Storage == nil {
+			allErrs = append(allErrs, field.Forbidden(dbPath.Child("storage"), "cannot be unset once set"))
+		} else if newDB.Storage.Cmp(*oldDB.Storage) < 0 {
+			allErrs = append(allErrs, field.Forbidden(dbPath.Child("storage"),
+				"cannot be decreased from "+oldDB.Storage.String()+" to "+newDB.Storage.String()))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *Bestie) toInvalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Bestie").GroupKind(), r.Name, allErrs)
+}
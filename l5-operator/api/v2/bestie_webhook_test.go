@@ -0,0 +1,389 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newBestie(mutate func(*Bestie)) *Bestie {
+	storage := resource.MustParse("1Gi")
+	b := &Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets"},
+		Spec: BestieSpec{
+			AgencyName: "Animal Humane Society",
+			App:        AppSpec{Replicas: 2},
+			Database: DatabaseSpec{
+				Provider:         DatabaseProviderPGO,
+				StorageClassName: "standard",
+				Storage:          &storage,
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(b)
+	}
+	return b
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func TestValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Bestie)
+		wantErr string
+	}{
+		{name: "valid"},
+		{
+			name:    "negative replicas",
+			mutate:  func(b *Bestie) { b.Spec.App.Replicas = -1 },
+			wantErr: "spec.app.replicas",
+		},
+		{
+			name:    "blank agency name",
+			mutate:  func(b *Bestie) { b.Spec.AgencyName = "  " },
+			wantErr: "spec.agencyName",
+		},
+		{
+			name:    "unknown provider",
+			mutate:  func(b *Bestie) { b.Spec.Database.Provider = "RDS" },
+			wantErr: "spec.database.provider",
+		},
+		{
+			name: "replicas within autoscaling bounds",
+			mutate: func(b *Bestie) {
+				b.Spec.App.Autoscaling = AutoscalingSpec{Enabled: true, MinReplicas: int32Ptr(1), MaxReplicas: 3}
+			},
+		},
+		{
+			name: "replicas above autoscaling bounds",
+			mutate: func(b *Bestie) {
+				b.Spec.App.Autoscaling = AutoscalingSpec{Enabled: true, MaxReplicas: 1}
+			},
+			wantErr: "spec.app.replicas",
+		},
+		{
+			name: "max below min replicas",
+			mutate: func(b *Bestie) {
+				b.Spec.App.Autoscaling = AutoscalingSpec{Enabled: true, MinReplicas: int32Ptr(3), MaxReplicas: 2}
+			},
+			wantErr: "spec.app.autoscaling.maxReplicas",
+		},
+		{
+			name: "invalid hibernation schedule",
+			mutate: func(b *Bestie) {
+				b.Spec.Hibernate.Schedule = &HibernateSchedule{Sleep: "every evening", Wake: "0 8 * * *"}
+			},
+			wantErr: "spec.hibernate.schedule.sleep",
+		},
+		{
+			name: "invalid credential rotation schedule",
+			mutate: func(b *Bestie) {
+				b.Spec.Database.CredentialRotation = &CredentialRotationSpec{Schedule: "monthly"}
+			},
+			wantErr: "spec.database.credentialRotation.schedule",
+		},
+		{
+			name: "invalid egress network",
+			mutate: func(b *Bestie) {
+				b.Spec.NetworkPolicy = NetworkPolicySpec{Enabled: true, Egress: &EgressPolicySpec{Enabled: true, AllowedCIDRs: []string{"203.0.113.1"}}}
+			},
+			wantErr: "spec.networkPolicy.egress.allowedCIDRs[0]",
+		},
+		{
+			name: "tls from the router",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.TLS = &TLSSpec{Termination: TLSTerminationReencrypt}
+			},
+		},
+		{
+			name: "tls from a secret without its name",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.TLS = &TLSSpec{Certificate: CertificateSpec{Source: CertificateFromSecret}}
+			},
+			wantErr: "spec.expose.tls.certificate.secretName",
+		},
+		{
+			name: "tls from cert-manager without a host",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.TLS = &TLSSpec{Certificate: CertificateSpec{IssuerRef: &IssuerReference{Name: "letsencrypt"}}}
+			},
+			wantErr: "spec.expose.host",
+		},
+		{
+			name: "gateway",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose = ExposeSpec{Type: ExposeGateway, ParentRef: &GatewayParentReference{Name: "public", Namespace: "gateways"}}
+			},
+		},
+		{
+			name:    "gateway without a parent",
+			mutate:  func(b *Bestie) { b.Spec.Expose.Type = ExposeGateway },
+			wantErr: "spec.expose.parentRef.name",
+		},
+		{
+			name: "gateway with tls",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose = ExposeSpec{
+					Type:      ExposeGateway,
+					ParentRef: &GatewayParentReference{Name: "public"},
+					TLS:       &TLSSpec{Termination: TLSTerminationEdge},
+				}
+			},
+			wantErr: "spec.expose.tls: Forbidden",
+		},
+		{
+			name: "load balancer service",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Service = ServiceSpec{
+					Type:                     corev1.ServiceTypeLoadBalancer,
+					Port:                     8080,
+					Annotations:              map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"},
+					LoadBalancerSourceRanges: []string{"192.0.2.0/24"},
+				}
+			},
+		},
+		{
+			name: "source ranges without a load balancer",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Service = ServiceSpec{Type: corev1.ServiceTypeNodePort, LoadBalancerSourceRanges: []string{"192.0.2.0/24"}}
+			},
+			wantErr: "spec.expose.service.loadBalancerSourceRanges",
+		},
+		{
+			name: "invalid source range",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Service = ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerSourceRanges: []string{"192.0.2.1"}}
+			},
+			wantErr: "spec.expose.service.loadBalancerSourceRanges[0]",
+		},
+		{
+			name: "invalid service annotation",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Service.Annotations = map[string]string{"not a key": "x"}
+			},
+			wantErr: "spec.expose.service.annotations",
+		},
+		{
+			name: "canary",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Type = ExposeRoute
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary, Steps: []int32{20, 50}}
+			},
+		},
+		{
+			name: "canary behind an ingress",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Type = ExposeIngress
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary}
+			},
+			wantErr: "spec.rollout.strategy",
+		},
+		{
+			name: "canary reencrypting",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose = ExposeSpec{Type: ExposeRoute, TLS: &TLSSpec{Termination: TLSTerminationReencrypt}}
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary}
+			},
+			wantErr: "reencrypt",
+		},
+		{
+			name: "decreasing canary steps",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Type = ExposeGateway
+				b.Spec.Expose.ParentRef = &GatewayParentReference{Name: "public"}
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary, Steps: []int32{50, 20}}
+			},
+			wantErr: "spec.rollout.steps[1]",
+		},
+		{
+			name: "blue green without a step duration",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Type = ExposeRoute
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutBlueGreen, StepDuration: &metav1.Duration{}}
+			},
+			wantErr: "spec.rollout.stepDuration",
+		},
+		{
+			name: "canary analysis without an address",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Type = ExposeRoute
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary, Analysis: &AnalysisSpec{Address: "prometheus:9090"}}
+			},
+			wantErr: "spec.rollout.analysis.address",
+		},
+		{
+			name: "canary analysis with a broken query",
+			mutate: func(b *Bestie) {
+				b.Spec.Expose.Type = ExposeRoute
+				b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary, Analysis: &AnalysisSpec{
+					Address:      "http://prometheus:9090",
+					LatencyQuery: `histogram_quantile(0.9, rate(latency_bucket{service="{{ .Service }"}[{{ .Interval }}]))`,
+				}}
+			},
+			wantErr: "spec.rollout.analysis.latencyQuery",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := newBestie(tt.mutate).ValidateCreate()
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     func(*Bestie)
+		mutate  func(*Bestie)
+		wantErr string
+	}{
+		{
+			name:   "scale app",
+			mutate: func(b *Bestie) { b.Spec.App.Replicas = 5 },
+		},
+		{
+			name: "grow storage",
+			mutate: func(b *Bestie) {
+				storage := resource.MustParse("2Gi")
+				b.Spec.Database.Storage = &storage
+			},
+		},
+		{
+			name: "shrink storage",
+			mutate: func(b *Bestie) {
+				storage := resource.MustParse("512Mi")
+				b.Spec.Database.Storage = &storage
+			},
+			wantErr: "spec.database.storage",
+		},
+		{
+			name:    "change storage class",
+			mutate:  func(b *Bestie) { b.Spec.Database.StorageClassName = "fast" },
+			wantErr: "spec.database.storageClassName",
+		},
+		{
+			name:    "set storage class",
+			old:     func(b *Bestie) { b.Spec.Database.StorageClassName = "" },
+			wantErr: "spec.database.storageClassName",
+		},
+		{
+			name:    "unset storage class",
+			mutate:  func(b *Bestie) { b.Spec.Database.StorageClassName = "" },
+			wantErr: "spec.database.storageClassName",
+		},
+		{
+			name:    "unset provider",
+			mutate:  func(b *Bestie) { b.Spec.Database.Provider = "" },
+			wantErr: "spec.database.provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := newBestie(tt.mutate).ValidateUpdate(newBestie(tt.old))
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+		})
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	g := NewWithT(t)
+
+	defaults := WebhookDefaults{
+		AppImage:   "quay.io/mkong/bestiev2",
+		AppVersion: "1.1",
+		AppResources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+		},
+		DatabaseStorage: resource.MustParse("1Gi"),
+		ExposeType:      ExposeIngress,
+	}
+
+	minimal := &Bestie{Spec: BestieSpec{
+		AgencyName: "Animal Humane Society",
+		App: AppSpec{
+			Replicas:    1,
+			Autoscaling: AutoscalingSpec{Enabled: true, MaxReplicas: 3},
+		},
+	}}
+	minimal.SetDefaults(defaults)
+	g.Expect(minimal.Spec.App.Image).To(Equal("quay.io/mkong/bestiev2"))
+	g.Expect(minimal.Spec.App.Version).To(Equal("1.1"))
+	g.Expect(minimal.Spec.App.Resources.Requests.Cpu().String()).To(Equal("100m"))
+	g.Expect(minimal.Spec.Database.Provider).To(Equal(DatabaseProviderPGO))
+	g.Expect(minimal.Spec.Database.Storage.String()).To(Equal("1Gi"))
+	g.Expect(minimal.Spec.Expose.Type).To(Equal(ExposeIngress))
+	g.Expect(minimal.Spec.Expose.Service.Type).To(Equal(corev1.ServiceTypeClusterIP))
+	g.Expect(minimal.Spec.Rollout).To(Equal(RolloutSpec{Strategy: RolloutRollingUpdate}))
+	g.Expect(*minimal.Spec.App.Autoscaling.MinReplicas).To(Equal(DefaultMinReplicas))
+	g.Expect(*minimal.Spec.App.Autoscaling.TargetCPUUtilizationPercentage).To(Equal(DefaultTargetCPUUtilizationPercentage))
+	g.Expect(minimal.ValidateCreate()).To(Succeed())
+
+	explicit := newBestie(func(b *Bestie) {
+		b.Spec.App.Version = "2.0"
+		b.Spec.Expose.Type = ExposeRoute
+	})
+	explicit.SetDefaults(defaults)
+	g.Expect(explicit.Spec.App.Version).To(Equal("2.0"))
+	g.Expect(explicit.Spec.Database.StorageClassName).To(Equal("standard"))
+	g.Expect(explicit.Spec.Expose.Type).To(Equal(ExposeRoute))
+
+	tls := newBestie(func(b *Bestie) {
+		b.Spec.Expose.TLS = &TLSSpec{Certificate: CertificateSpec{IssuerRef: &IssuerReference{Name: "letsencrypt"}}}
+	})
+	tls.SetDefaults(defaults)
+	g.Expect(tls.Spec.Expose.TLS.Termination).To(Equal(TLSTerminationEdge))
+	g.Expect(tls.Spec.Expose.TLS.Certificate.Source).To(Equal(CertificateFromCertManager))
+	g.Expect(tls.Spec.Expose.TLS.Certificate.IssuerRef.Kind).To(Equal(IssuerKind))
+
+	canary := newBestie(func(b *Bestie) {
+		b.Spec.Expose.Type = ExposeRoute
+		b.Spec.Rollout.Strategy = RolloutCanary
+	})
+	canary.SetDefaults(defaults)
+	g.Expect(canary.Spec.Rollout.Steps).To(Equal(DefaultCanarySteps))
+	g.Expect(canary.Spec.Rollout.StepDuration.Duration).To(Equal(DefaultStepDuration))
+	g.Expect(canary.Spec.Rollout.EffectiveSteps()).To(Equal([]int32{10, 25, 50, 100}))
+
+	analysed := newBestie(func(b *Bestie) {
+		b.Spec.Expose.Type = ExposeRoute
+		b.Spec.Rollout = RolloutSpec{Strategy: RolloutCanary, Analysis: &AnalysisSpec{Address: "http://prometheus:9090"}}
+	})
+	analysed.SetDefaults(defaults)
+	g.Expect(*analysed.Spec.Rollout.Analysis.MaxErrorRateIncrease).To(Equal(DefaultMaxErrorRateIncrease))
+	g.Expect(*analysed.Spec.Rollout.Analysis.MaxLatencyIncrease).To(Equal(DefaultMaxLatencyIncrease))
+	g.Expect(analysed.Spec.Rollout.Analysis.EffectiveErrorRateQuery()).To(Equal(DefaultErrorRateQuery))
+}
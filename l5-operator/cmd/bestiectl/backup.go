@@ -0,0 +1,189 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// pgBackRestBackupAnnotation and pgBackRestRestoreAnnotation make PGO run
+	// the manual backup or the restore set in the PostgresCluster spec. Each
+	// new value triggers a new run.
+	pgBackRestBackupAnnotation  = "postgres-operator.crunchydata.com/pgbackrest-backup"
+	pgBackRestRestoreAnnotation = "postgres-operator.crunchydata.com/pgbackrest-restore"
+
+	// pgBackRestTimeFormat is the timestamp format of pgBackRest restore targets.
+	pgBackRestTimeFormat = "2006-01-02 15:04:05-07"
+)
+
+var backupCommand = command{
+	name:  "backup",
+	usage: "backup NAME [flags]",
+	short: "Take a backup of the database of a Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		o := &backupOptions{}
+		fs.StringVar(&o.backupType, "type", "full", "Type of the backup: full, diff or incr.")
+		fs.StringVar(&o.repo, "repo", "", "pgBackRest repository to back up to. Defaults to the first one.")
+		return func(ctx context.Context, args []string) error { return c.backup(ctx, args, o) }
+	},
+}
+
+type backupOptions struct {
+	backupType string
+	repo       string
+}
+
+var restoreCommand = command{
+	name:  "restore",
+	usage: "restore NAME --yes [flags]",
+	short: "Restore the database of a Bestie in place",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		o := &restoreOptions{}
+		fs.StringVar(&o.to, "to", "", "Point in time to restore to, in RFC 3339 format. Defaults to the end of the latest backup.")
+		fs.StringVar(&o.repo, "repo", "", "pgBackRest repository to restore from. Defaults to the first one.")
+		fs.BoolVar(&o.yes, "yes", false, "Confirm that the current database content is to be overwritten.")
+		return func(ctx context.Context, args []string) error { return c.restore(ctx, args, o) }
+	},
+}
+
+type restoreOptions struct {
+	to   string
+	repo string
+	yes  bool
+}
+
+func (c *cli) backup(ctx context.Context, args []string, o *backupOptions) error {
+	switch o.backupType {
+	case "full", "diff", "incr":
+	default:
+		return fmt.Errorf("invalid --type %q, must be full, diff or incr", o.backupType)
+	}
+	pgo, err := c.database(ctx, args)
+	if err != nil {
+		return err
+	}
+	repo, err := backupRepo(pgo, o.repo)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(pgo.DeepCopy())
+	pgo.Spec.Backups.PGBackRest.Manual = &pgov1.PGBackRestManualBackup{
+		RepoName: repo,
+		Options:  []string{"--type=" + o.backupType},
+	}
+	setAnnotation(pgo, pgBackRestBackupAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err := c.client.Patch(ctx, pgo, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s backup of bestie/%s to %s requested\n", o.backupType, args[0], repo)
+	return nil
+}
+
+func (c *cli) restore(ctx context.Context, args []string, o *restoreOptions) error {
+	if !o.yes {
+		return errors.New("restore overwrites the current database content, pass --yes to confirm")
+	}
+	var options []string
+	if o.to != "" {
+		target, err := time.Parse(time.RFC3339, o.to)
+		if err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+		options = []string{"--type=time", fmt.Sprintf("--target=%q", target.Format(pgBackRestTimeFormat))}
+	}
+	pgo, err := c.database(ctx, args)
+	if err != nil {
+		return err
+	}
+	repo, err := backupRepo(pgo, o.repo)
+	if err != nil {
+		return err
+	}
+
+	enabled := true
+	patch := client.MergeFrom(pgo.DeepCopy())
+	pgo.Spec.Backups.PGBackRest.Restore = &pgov1.PGBackRestRestore{
+		Enabled: &enabled,
+		PostgresClusterDataSource: &pgov1.PostgresClusterDataSource{
+			RepoName: repo,
+			Options:  options,
+		},
+	}
+	setAnnotation(pgo, pgBackRestRestoreAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err := c.client.Patch(ctx, pgo, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "restore of bestie/%s from %s requested, the database is unavailable until it completes\n", args[0], repo)
+	return nil
+}
+
+// database returns the PostgresCluster of the Bestie named in args.
+func (c *cli) database(ctx context.Context, args []string) (*pgov1.PostgresCluster, error) {
+	name, err := oneName(args)
+	if err != nil {
+		return nil, err
+	}
+	bestie, err := c.pets.PetsV1().Besties(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	comps, err := c.components(ctx, bestie)
+	if err != nil {
+		return nil, err
+	}
+	if comps.database == nil {
+		return nil, fmt.Errorf("bestie/%s has no PostgresCluster yet", name)
+	}
+	return comps.database, nil
+}
+
+// backupRepo returns the pgBackRest repository named repo, or the first
+// repository of pgo when repo is empty.
+func backupRepo(pgo *pgov1.PostgresCluster, repo string) (string, error) {
+	repos := pgo.Spec.Backups.PGBackRest.Repos
+	if len(repos) == 0 {
+		return "", fmt.Errorf("PostgresCluster %s has no pgBackRest repository", pgo.Name)
+	}
+	if repo == "" {
+		return repos[0].Name, nil
+	}
+	for _, r := range repos {
+		if r.Name == repo {
+			return repo, nil
+		}
+	}
+	return "", fmt.Errorf("PostgresCluster %s has no pgBackRest repository %q", pgo.Name, repo)
+}
+
+func setAnnotation(obj client.Object, key, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	"github.com/opdev/l5-operator-demo/l5-operator/controllers"
+	petsfake "github.com/opdev/l5-operator-demo/l5-operator/pkg/client/clientset/versioned/fake"
+)
+
+const namespace = "pets"
+
+func instanceLabels(extra map[string]string) map[string]string {
+	l := map[string]string{
+		controllers.LabelManagedBy: controllers.ManagedByValue,
+		controllers.LabelInstance:  "bestie",
+	}
+	for k, v := range extra {
+		l[k] = v
+	}
+	return l
+}
+
+// newTestCLI returns a cli backed by fake clients holding a running Bestie
+// stack, and the buffer its output goes to.
+func newTestCLI(extra ...runtime.Object) (*cli, *bytes.Buffer) {
+	replicas := int32(2)
+	completed := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	bestie := &petsv1.Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: namespace, Annotations: map[string]string{petsv1.PausedAnnotation: "true"}},
+		Spec:       petsv1.BestieSpec{Size: 2, AgencyName: "Animal Humane Society"},
+		Status: petsv1.BestieStatus{
+			PodStatus: "Running",
+			Conditions: []metav1.Condition{{
+				Type: petsv1.ConditionMaintenance, Status: metav1.ConditionFalse, Reason: "AppServed", Message: "Traffic is served by the bestie app",
+			}},
+		},
+	}
+	app := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-app", Namespace: namespace, UID: "bestie-app-uid", Labels: instanceLabels(map[string]string{"app": appLabel})},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": appLabel}},
+		},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-job", Namespace: namespace, Labels: instanceLabels(map[string]string{"app": appLabel})},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+		}},
+	}
+	// PGO copies the instance labels onto its own Jobs.
+	backupJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo-backup", Namespace: namespace, Labels: instanceLabels(nil)},
+	}
+	appPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-app-1", Namespace: namespace, Labels: map[string]string{"app": appLabel}},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "check-db-ready"}},
+			Containers:     []corev1.Container{{Name: "bestie"}},
+		},
+	}
+	jobPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-job-1", Namespace: namespace, Labels: map[string]string{"job-name": "bestie-job"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "bestie-job"}}},
+	}
+	pgo := &pgov1.PostgresCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo", Namespace: namespace, Labels: instanceLabels(nil)},
+		Spec: pgov1.PostgresClusterSpec{
+			Backups: pgov1.Backups{PGBackRest: pgov1.PGBackRestArchive{Repos: []pgov1.PGBackRestRepo{{Name: "repo1"}}}},
+		},
+		Status: pgov1.PostgresClusterStatus{
+			InstanceSets: []pgov1.PostgresInstanceSetStatus{{Name: "instance1", Replicas: 1, ReadyReplicas: 1}},
+			PGBackRest: &pgov1.PGBackRestStatus{
+				ScheduledBackups: []pgov1.PGBackRestScheduledBackupStatus{{Type: "full", Succeeded: 1, CompletionTime: &completed}},
+			},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	return &cli{
+		out:          out,
+		errOut:       &bytes.Buffer{},
+		loadingRules: &clientcmd.ClientConfigLoadingRules{},
+		namespace:    namespace,
+		pets:         petsfake.NewSimpleClientset(bestie),
+		kube:         kubefake.NewSimpleClientset(append([]runtime.Object{app, job, backupJob, appPod, jobPod}, extra...)...),
+		client:       fake.NewClientBuilder().WithScheme(scheme).WithObjects(pgo).Build(),
+	}, out
+}
+
+func TestList(t *testing.T) {
+	g := NewWithT(t)
+	c, out := newTestCLI()
+
+	g.Expect(c.run(context.Background(), "bestiectl", []string{"list"})).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("NAME"))
+	g.Expect(out.String()).To(MatchRegexp(`bestie\s+1/2\s+1/1\s+Complete\s+-\s+Paused`))
+}
+
+func TestStatus(t *testing.T) {
+	g := NewWithT(t)
+	c, out := newTestCLI()
+
+	g.Expect(c.run(context.Background(), "bestiectl", []string{"status", "bestie"})).To(Succeed())
+	g.Expect(out.String()).To(MatchRegexp(`Database:\s+Healthy \(1/1 instances ready\)`))
+	g.Expect(out.String()).To(MatchRegexp(`Last backup:\s+\S+ \(full, 60m ago\)`))
+	g.Expect(out.String()).To(MatchRegexp(`Maintenance\s+False\s+AppServed`))
+}
+
+func TestPauseResume(t *testing.T) {
+	g := NewWithT(t)
+	c, _ := newTestCLI()
+	ctx := context.Background()
+
+	g.Expect(c.run(ctx, "bestiectl", []string{"pause", "bestie"})).To(Succeed())
+	bestie, err := c.pets.PetsV1().Besties(namespace).Get(ctx, "bestie", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bestie.Spec.Paused).To(BeTrue())
+
+	g.Expect(c.run(ctx, "bestiectl", []string{"resume", "bestie"})).To(Succeed())
+	bestie, err = c.pets.PetsV1().Besties(namespace).Get(ctx, "bestie", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bestie.IsPaused()).To(BeFalse())
+	g.Expect(bestie.Annotations).NotTo(HaveKey(petsv1.PausedAnnotation))
+}
+
+func TestRestart(t *testing.T) {
+	g := NewWithT(t)
+	c, out := newTestCLI()
+	ctx := context.Background()
+
+	g.Expect(c.run(ctx, "bestiectl", []string{"restart", "bestie"})).To(Succeed())
+	g.Expect(out.String()).To(Equal("bestie/bestie restarted\n"))
+	bestie, err := c.pets.PetsV1().Besties(namespace).Get(ctx, "bestie", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bestie.Annotations).To(HaveKey(petsv1.RestartedAtAnnotation))
+	g.Expect(bestie.Annotations).To(HaveKey(petsv1.PausedAnnotation))
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	g := NewWithT(t)
+	c, _ := newTestCLI()
+	ctx := context.Background()
+	key := client.ObjectKey{Name: "bestie-pgo", Namespace: namespace}
+
+	g.Expect(c.run(ctx, "bestiectl", []string{"backup", "bestie", "--type", "diff"})).To(Succeed())
+	pgo := &pgov1.PostgresCluster{}
+	g.Expect(c.client.Get(ctx, key, pgo)).To(Succeed())
+	g.Expect(pgo.Annotations).To(HaveKey(pgBackRestBackupAnnotation))
+	g.Expect(pgo.Spec.Backups.PGBackRest.Manual).To(Equal(&pgov1.PGBackRestManualBackup{RepoName: "repo1", Options: []string{"--type=diff"}}))
+
+	g.Expect(c.run(ctx, "bestiectl", []string{"restore", "bestie"})).To(MatchError(ContainSubstring("--yes")))
+	g.Expect(c.run(ctx, "bestiectl", []string{"restore", "bestie", "--yes", "--to", "2022-03-01T10:00:00Z"})).To(Succeed())
+	g.Expect(c.client.Get(ctx, key, pgo)).To(Succeed())
+	g.Expect(pgo.Annotations).To(HaveKey(pgBackRestRestoreAnnotation))
+	g.Expect(pgo.Spec.Backups.PGBackRest.Restore.RepoName).To(Equal("repo1"))
+	g.Expect(pgo.Spec.Backups.PGBackRest.Restore.Options).To(Equal([]string{"--type=time", `--target="2022-03-01 10:00:00+00"`}))
+}
+
+func TestLogs(t *testing.T) {
+	g := NewWithT(t)
+	c, out := newTestCLI()
+
+	g.Expect(c.run(context.Background(), "bestiectl", []string{"logs", "bestie"})).To(Succeed())
+	g.Expect(out.String()).To(Equal("[bestie-app-1/check-db-ready] fake logs\n" +
+		"[bestie-app-1/bestie] fake logs\n" +
+		"[bestie-job-1/bestie-job] fake logs\n"))
+}
+
+func TestGather(t *testing.T) {
+	g := NewWithT(t)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo-pguser-bestie", Namespace: namespace, Labels: instanceLabels(nil)},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "bestie-app.1", Namespace: namespace},
+		InvolvedObject: corev1.ObjectReference{Kind: "Deployment", Name: "bestie-app", UID: "bestie-app-uid"},
+		Reason:         "ScalingReplicaSet",
+	}
+	unrelated := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "other.1", Namespace: namespace},
+		InvolvedObject: corev1.ObjectReference{Kind: "Deployment", Name: "other", UID: "other-uid"},
+		Reason:         "Unrelated",
+	}
+	operator := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: operatorDeployment, Namespace: "l5-operator-system", Labels: map[string]string{"olm.owner": "l5-operator.v0.0.1"}},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"control-plane": "controller-manager"}},
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "manager",
+				Image: "quay.io/opdev/l5-operator:v0.0.1",
+				Env:   []corev1.EnvVar{{Name: "API_TOKEN", Value: "s3cr3t"}, {Name: "LOG_LEVEL", Value: "debug"}},
+			}}}},
+		},
+	}
+	operatorPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "l5-operator-1", Namespace: "l5-operator-system", Labels: map[string]string{"control-plane": "controller-manager"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "manager"}}},
+	}
+	c, out := newTestCLI(secret, event, unrelated, operator, operatorPod)
+	output := filepath.Join(t.TempDir(), "bundle.tar.gz")
+
+	g.Expect(c.run(context.Background(), "bestiectl", []string{"gather", "bestie", "-o", output})).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring(output))
+
+	files := readBundle(t, output)
+	g.Expect(files).To(HaveKey("bestie.yaml"))
+	g.Expect(files).To(HaveKey("summary.txt"))
+	g.Expect(files).To(HaveKey("objects/deployment/bestie-app.yaml"))
+	g.Expect(files).To(HaveKey("objects/job/bestie-pgo-backup.yaml"))
+	g.Expect(files).To(HaveKey("objects/postgrescluster/bestie-pgo.yaml"))
+	g.Expect(files).To(HaveKey("objects/pod/bestie-app-1.yaml"))
+	g.Expect(files).NotTo(HaveKey("objects/deployment/" + operatorDeployment + ".yaml"))
+	g.Expect(files["objects/secret/bestie-pgo-pguser-bestie.yaml"]).To(ContainSubstring("password: REDACTED"))
+	g.Expect(files["events.yaml"]).To(ContainSubstring("ScalingReplicaSet"))
+	g.Expect(files["events.yaml"]).NotTo(ContainSubstring("Unrelated"))
+	g.Expect(files["logs/bestie-app-1/check-db-ready.log"]).To(Equal("fake logs\n"))
+	g.Expect(files["logs/bestie-job-1/bestie-job.log"]).To(Equal("fake logs\n"))
+	g.Expect(files["errors.txt"]).NotTo(ContainSubstring("HTTPRoute"))
+	g.Expect(files["operator/l5-operator-system/logs/l5-operator-1/manager.log"]).To(Equal("fake logs\n"))
+	g.Expect(files["operator/l5-operator-system/version.txt"]).To(ContainSubstring("ClusterServiceVersion: l5-operator.v0.0.1"))
+	g.Expect(files["operator/l5-operator-system/deployment.yaml"]).To(ContainSubstring("value: REDACTED"))
+	g.Expect(files["operator/l5-operator-system/deployment.yaml"]).To(ContainSubstring("value: debug"))
+	for name, content := range files {
+		g.Expect(content).NotTo(ContainSubstring("hunter2"), name)
+		g.Expect(content).NotTo(ContainSubstring("s3cr3t"), name)
+	}
+}
+
+// readBundle returns the files of the support bundle at name, keyed by their
+// path below the bundle directory.
+func readBundle(t *testing.T, name string) map[string]string {
+	t.Helper()
+	g := NewWithT(t)
+	f, err := os.Open(name)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	g.Expect(err).NotTo(HaveOccurred())
+	tr := tar.NewReader(gz)
+
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(header.Name).To(HavePrefix("bestie-pets-bestie-"))
+		content, err := io.ReadAll(tr)
+		g.Expect(err).NotTo(HaveOccurred())
+		files[header.Name[strings.Index(header.Name, "/")+1:]] = string(content)
+	}
+}
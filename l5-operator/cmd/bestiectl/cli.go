@@ -0,0 +1,175 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/client/clientset/versioned"
+)
+
+// scheme holds the third-party APIs read through the generic client. Besties
+// and the core APIs go through their typed clientsets.
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(pgov1.AddToScheme(scheme))
+	utilruntime.Must(routev1.AddToScheme(scheme))
+}
+
+// command is a bestiectl subcommand.
+type command struct {
+	name  string
+	usage string
+	short string
+	// setup binds the flags of the command and returns the function running
+	// it with the remaining positional arguments.
+	setup func(c *cli, fs *pflag.FlagSet) func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	createCommand,
+	listCommand,
+	statusCommand,
+	backupCommand,
+	restoreCommand,
+	pauseCommand,
+	resumeCommand,
+	restartCommand,
+	logsCommand,
+	gatherCommand,
+}
+
+// cli holds the clients and output streams shared by every command.
+type cli struct {
+	out    io.Writer
+	errOut io.Writer
+
+	loadingRules *clientcmd.ClientConfigLoadingRules
+	overrides    clientcmd.ConfigOverrides
+
+	// Set by connect, or up front by tests.
+	namespace string
+	pets      versioned.Interface
+	kube      kubernetes.Interface
+	client    client.Client
+}
+
+// run parses args and runs the command they name. prog is how bestiectl was
+// invoked, for the usage text.
+func (c *cli) run(ctx context.Context, prog string, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.usage(prog)
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := pflag.NewFlagSet(prog+" "+cmd.name, pflag.ContinueOnError)
+		fs.SetOutput(c.errOut)
+		fs.Usage = func() {
+			fmt.Fprintf(c.errOut, "%s\n\nUsage:\n  %s %s\n\nFlags:\n%s", cmd.short, prog, cmd.usage, fs.FlagUsages())
+		}
+		runCmd := cmd.setup(c, fs)
+		c.bindClientFlags(fs)
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, pflag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+		if err := c.connect(); err != nil {
+			return err
+		}
+		return runCmd(ctx, fs.Args())
+	}
+	return fmt.Errorf("unknown command %q, see %s --help", args[0], prog)
+}
+
+func (c *cli) usage(prog string) {
+	fmt.Fprintf(c.out, "%s runs day-2 operations against Bestie instances.\n\nCommands:\n", prog)
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.short)
+	}
+	w.Flush()
+	fmt.Fprintf(c.out, "\nRun %s COMMAND --help for the flags of a command.\n", prog)
+}
+
+// bindClientFlags binds the kubeconfig flags kubectl understands, e.g.
+// --kubeconfig, --context and -n/--namespace.
+func (c *cli) bindClientFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	clientcmd.BindOverrideFlags(&c.overrides, fs, clientcmd.RecommendedConfigOverrideFlags(""))
+}
+
+// connect builds the clients from the kubeconfig, unless they are set
+// already.
+func (c *cli) connect() error {
+	if c.pets != nil {
+		return nil
+	}
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c.loadingRules, &c.overrides)
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return err
+	}
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	// Discover lazily, so that commands not touching PGO or Routes work on
+	// clusters without them.
+	mapper, err := apiutil.NewDynamicRESTMapper(restConfig, apiutil.WithLazyDiscovery)
+	if err != nil {
+		return err
+	}
+	if c.client, err = client.New(restConfig, client.Options{Scheme: scheme, Mapper: mapper}); err != nil {
+		return err
+	}
+	if c.kube, err = kubernetes.NewForConfig(restConfig); err != nil {
+		return err
+	}
+	if c.pets, err = versioned.NewForConfig(restConfig); err != nil {
+		return err
+	}
+	c.namespace = namespace
+	return nil
+}
+
+// oneName returns the single Bestie name in args.
+func oneName(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("expected exactly one Bestie name")
+	}
+	return args[0], nil
+}
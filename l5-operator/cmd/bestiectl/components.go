@@ -0,0 +1,293 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	"github.com/opdev/l5-operator-demo/l5-operator/controllers"
+)
+
+// appLabel is the "app" label of the app Deployment, migration Job and
+// Service in config/resources. PGO copies the Bestie labels onto the objects
+// it creates for the database, so the instance label alone does not single
+// out the operator's own components.
+const appLabel = "bestie"
+
+// components are the objects the operator created for a Bestie. Missing
+// components are nil.
+type components struct {
+	app      *appsv1.Deployment
+	job      *batchv1.Job
+	service  *corev1.Service
+	database *pgov1.PostgresCluster
+	route    *routev1.Route
+	ingress  *networkingv1.Ingress
+}
+
+// components looks up the objects of bestie by the labels the operator sets.
+func (c *cli) components(ctx context.Context, bestie *petsv1.Bestie) (*components, error) {
+	instance := labels.Set{
+		controllers.LabelManagedBy: controllers.ManagedByValue,
+		controllers.LabelInstance:  bestie.Name,
+	}
+	app := labels.Merge(instance, labels.Set{"app": appLabel})
+	appOpts := metav1.ListOptions{LabelSelector: app.String()}
+	ns := bestie.Namespace
+	comps := &components{}
+
+	deployments, err := c.kube.AppsV1().Deployments(ns).List(ctx, appOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(deployments.Items) > 0 {
+		comps.app = &deployments.Items[0]
+	}
+	jobs, err := c.kube.BatchV1().Jobs(ns).List(ctx, appOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs.Items) > 0 {
+		comps.job = &jobs.Items[0]
+	}
+	services, err := c.kube.CoreV1().Services(ns).List(ctx, appOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(services.Items) > 0 {
+		comps.service = &services.Items[0]
+	}
+	ingresses, err := c.kube.NetworkingV1().Ingresses(ns).List(ctx, metav1.ListOptions{LabelSelector: instance.String()})
+	if err != nil {
+		return nil, err
+	}
+	if len(ingresses.Items) > 0 {
+		comps.ingress = &ingresses.Items[0]
+	}
+
+	// PGO and Routes are optional APIs; a cluster without them simply has
+	// none of these components.
+	opts := []client.ListOption{client.InNamespace(ns), client.MatchingLabels(instance)}
+	clusters := &pgov1.PostgresClusterList{}
+	if err := c.client.List(ctx, clusters, opts...); err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	if len(clusters.Items) > 0 {
+		comps.database = &clusters.Items[0]
+	}
+	routes := &routev1.RouteList{}
+	if err := c.client.List(ctx, routes, opts...); err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	if len(routes.Items) > 0 {
+		comps.route = &routes.Items[0]
+	}
+	return comps, nil
+}
+
+// appReadiness returns the ready and desired replicas of the app.
+func (comps *components) appReadiness() string {
+	dp := comps.app
+	if dp == nil {
+		return "-"
+	}
+	desired := int32(1)
+	if dp.Spec.Replicas != nil {
+		desired = *dp.Spec.Replicas
+	}
+	return fmt.Sprintf("%d/%d", dp.Status.ReadyReplicas, desired)
+}
+
+// databaseReadiness returns the ready and desired Postgres instances.
+func (comps *components) databaseReadiness() string {
+	pgo := comps.database
+	if pgo == nil {
+		return "-"
+	}
+	if pgo.Spec.Shutdown != nil && *pgo.Spec.Shutdown {
+		return "Shutdown"
+	}
+	var ready, desired int32
+	for _, set := range pgo.Status.InstanceSets {
+		ready += set.ReadyReplicas
+		desired += set.Replicas
+	}
+	return fmt.Sprintf("%d/%d", ready, desired)
+}
+
+// databaseHealth describes whether the database accepts connections.
+func (comps *components) databaseHealth() string {
+	pgo := comps.database
+	switch {
+	case pgo == nil:
+		return "Missing"
+	case pgo.Spec.Shutdown != nil && *pgo.Spec.Shutdown:
+		return "Shut down"
+	case pgo.Status.PGBackRest != nil && pgo.Status.PGBackRest.Restore != nil && !pgo.Status.PGBackRest.Restore.Finished:
+		return "Restoring"
+	}
+	for _, set := range pgo.Status.InstanceSets {
+		if set.ReadyReplicas < set.Replicas {
+			return fmt.Sprintf("Degraded (%s instances ready)", comps.databaseReadiness())
+		}
+	}
+	if len(pgo.Status.InstanceSets) == 0 {
+		return "Not ready"
+	}
+	return fmt.Sprintf("Healthy (%s instances ready)", comps.databaseReadiness())
+}
+
+// migrationState returns the state of the migration Job.
+func (comps *components) migrationState() string {
+	job := comps.job
+	if job == nil {
+		return "-"
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return "Complete"
+		case batchv1.JobFailed:
+			return "Failed"
+		}
+	}
+	if job.Status.Active > 0 {
+		return "Running"
+	}
+	return "Pending"
+}
+
+// exposure returns the kind of object exposing the app and whether it is
+// serving yet.
+func (comps *components) exposure() string {
+	switch {
+	case comps.route != nil:
+		for _, ingress := range comps.route.Status.Ingress {
+			for _, cond := range ingress.Conditions {
+				if cond.Type == routev1.RouteAdmitted && cond.Status == corev1.ConditionTrue {
+					return "Route"
+				}
+			}
+		}
+		return "Route (not admitted)"
+	case comps.ingress != nil:
+		if len(comps.ingress.Status.LoadBalancer.Ingress) == 0 {
+			return "Ingress (no address)"
+		}
+		return "Ingress"
+	}
+	return "-"
+}
+
+// url returns the address the app is reachable at from outside the
+// cluster, if it has one yet.
+func (comps *components) url() string {
+	if route := comps.route; route != nil {
+		host := route.Spec.Host
+		for _, ingress := range route.Status.Ingress {
+			if ingress.Host != "" {
+				host = ingress.Host
+				break
+			}
+		}
+		if host == "" {
+			return ""
+		}
+		if route.Spec.TLS != nil {
+			return "https://" + host
+		}
+		return "http://" + host
+	}
+	if ingress := comps.ingress; ingress != nil {
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" {
+				return "http://" + rule.Host
+			}
+		}
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if lb.Hostname != "" {
+				return "http://" + lb.Hostname
+			}
+			if lb.IP != "" {
+				return "http://" + lb.IP
+			}
+		}
+	}
+	return ""
+}
+
+// lastBackup returns the most recent successful pgBackRest backup, manual or
+// scheduled, or nil when there is none.
+func (comps *components) lastBackup() *backupInfo {
+	if comps.database == nil || comps.database.Status.PGBackRest == nil {
+		return nil
+	}
+	status := comps.database.Status.PGBackRest
+	var last *backupInfo
+	consider := func(kind string, succeeded int32, completed *metav1.Time) {
+		if succeeded == 0 || completed == nil {
+			return
+		}
+		if last == nil || completed.After(last.completed.Time) {
+			last = &backupInfo{kind: kind, completed: *completed}
+		}
+	}
+	if manual := status.ManualBackup; manual != nil {
+		consider("manual", manual.Succeeded, manual.CompletionTime)
+	}
+	for _, scheduled := range status.ScheduledBackups {
+		consider(scheduled.Type, scheduled.Succeeded, scheduled.CompletionTime)
+	}
+	return last
+}
+
+// backupInfo describes a completed backup.
+type backupInfo struct {
+	kind      string
+	completed metav1.Time
+}
+
+// phase summarizes the state of bestie in one word.
+func phase(bestie *petsv1.Bestie) string {
+	switch {
+	case bestie.IsPaused():
+		return "Paused"
+	case meta.IsStatusConditionTrue(bestie.Status.Conditions, petsv1.ConditionHibernated):
+		return "Hibernated"
+	case meta.IsStatusConditionTrue(bestie.Status.Conditions, petsv1.ConditionMaintenance):
+		return "Maintenance"
+	case bestie.Status.PodStatus != "":
+		return bestie.Status.PodStatus
+	}
+	return "Pending"
+}
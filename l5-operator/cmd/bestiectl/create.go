@@ -0,0 +1,102 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+)
+
+var createCommand = command{
+	name:  "create",
+	usage: "create NAME --agency-name AGENCY [flags]",
+	short: "Create a Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		o := &createOptions{}
+		fs.StringVar(&o.agencyName, "agency-name", "", "Name of the agency shown by the app. Required.")
+		fs.Int32Var(&o.size, "size", 1, "Number of app replicas.")
+		fs.StringVar(&o.image, "image", "", "App image, without a tag. Defaults to the operator-wide image.")
+		fs.StringVar(&o.version, "app-version", "", "App image tag. Defaults to the operator-wide version.")
+		fs.StringVar(&o.expose, "expose", "", "How the app is exposed, Route or Ingress. Defaults to the platform default.")
+		fs.StringVar(&o.storage, "storage", "", "Size of the database volume, e.g. 5Gi. Defaults to the operator-wide size.")
+		fs.StringVar(&o.storageClass, "storage-class", "", "Storage class of the database volume.")
+		fs.BoolVar(&o.dryRun, "dry-run", false, "Print the Bestie instead of creating it.")
+		return func(ctx context.Context, args []string) error { return c.create(ctx, args, o) }
+	},
+}
+
+type createOptions struct {
+	agencyName   string
+	size         int32
+	image        string
+	version      string
+	expose       string
+	storage      string
+	storageClass string
+	dryRun       bool
+}
+
+func (c *cli) create(ctx context.Context, args []string, o *createOptions) error {
+	name, err := oneName(args)
+	if err != nil {
+		return err
+	}
+	if o.agencyName == "" {
+		return errors.New("--agency-name is required")
+	}
+
+	bestie := &petsv1.Bestie{
+		TypeMeta:   metav1.TypeMeta{APIVersion: petsv1.GroupVersion.String(), Kind: "Bestie"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.namespace},
+		Spec: petsv1.BestieSpec{
+			Size:       o.size,
+			AgencyName: o.agencyName,
+			App:        petsv1.AppSpec{Image: o.image, Version: o.version},
+			Database:   petsv1.DatabaseSpec{StorageClassName: o.storageClass},
+			Expose:     petsv1.ExposeSpec{Type: petsv1.ExposeType(o.expose)},
+		},
+	}
+	if o.storage != "" {
+		storage, err := resource.ParseQuantity(o.storage)
+		if err != nil {
+			return fmt.Errorf("invalid --storage: %w", err)
+		}
+		bestie.Spec.Database.Storage = &storage
+	}
+
+	if o.dryRun {
+		out, err := yaml.Marshal(bestie)
+		if err != nil {
+			return err
+		}
+		_, err = c.out.Write(out)
+		return err
+	}
+	if _, err := c.pets.PetsV1().Besties(c.namespace).Create(ctx, bestie, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "bestie/%s created\n", name)
+	return nil
+}
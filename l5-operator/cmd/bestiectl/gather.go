@@ -0,0 +1,525 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	"github.com/opdev/l5-operator-demo/l5-operator/controllers"
+)
+
+const (
+	// operatorDeployment is the name of the operator Deployment, both when
+	// deployed with kustomize and through OLM.
+	operatorDeployment = "l5-operator-controller-manager"
+
+	// redacted replaces every secret value in a bundle.
+	redacted = "REDACTED"
+)
+
+var gatherCommand = command{
+	name:  "gather",
+	usage: "gather NAME [flags]",
+	short: "Collect a support bundle of a Bestie into a tarball",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		o := &gatherOptions{}
+		fs.StringVarP(&o.output, "output", "o", "", "File to write the bundle to, - for stdout. Defaults to bestie-NAMESPACE-NAME-TIMESTAMP.tar.gz.")
+		fs.StringVar(&o.operatorNamespace, "operator-namespace", "", "Namespace of the operator. Every namespace is searched when empty.")
+		fs.Int64Var(&o.tail, "tail", 2000, "Number of recent lines to collect per container. All lines when negative.")
+		fs.DurationVar(&o.since, "since", 0, "Only collect log lines newer than this duration, e.g. 24h.")
+		return func(ctx context.Context, args []string) error { return c.gather(ctx, args, o) }
+	},
+}
+
+type gatherOptions struct {
+	output            string
+	operatorNamespace string
+	tail              int64
+	since             time.Duration
+}
+
+// gatherKind is a kind of object collected by label into a bundle.
+type gatherKind struct {
+	gvk  schema.GroupVersionKind
+	list func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error)
+}
+
+// gatherKinds are the kinds of the objects of a Bestie. Besides the objects
+// the operator creates, they cover those PGO creates for the database, which
+// carry the Bestie labels too.
+var gatherKinds = []gatherKind{
+	{appsv1.SchemeGroupVersion.WithKind("Deployment"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{appsv1.SchemeGroupVersion.WithKind("StatefulSet"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{batchv1.SchemeGroupVersion.WithKind("Job"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{batchv1.SchemeGroupVersion.WithKind("CronJob"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.BatchV1().CronJobs(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{corev1.SchemeGroupVersion.WithKind("Pod"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{corev1.SchemeGroupVersion.WithKind("Service"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.CoreV1().Services(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{corev1.SchemeGroupVersion.WithKind("ConfigMap"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.CoreV1().ConfigMaps(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{corev1.SchemeGroupVersion.WithKind("Secret"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.CoreV1().PersistentVolumeClaims(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{networkingv1.SchemeGroupVersion.WithKind("Ingress"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.NetworkingV1().Ingresses(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{autoscalingv2.SchemeGroupVersion.WithKind("HorizontalPodAutoscaler"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		return c.kube.AutoscalingV2().HorizontalPodAutoscalers(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	}},
+	{pgov1.GroupVersion.WithKind("PostgresCluster"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		list := &pgov1.PostgresClusterList{}
+		return list, c.client.List(ctx, list, client.InNamespace(ns), client.MatchingLabels(selector))
+	}},
+	{routev1.SchemeGroupVersion.WithKind("Route"), func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		list := &routev1.RouteList{}
+		return list, c.client.List(ctx, list, client.InNamespace(ns), client.MatchingLabels(selector))
+	}},
+	unstructuredKind(schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}),
+	unstructuredKind(schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}),
+}
+
+// unstructuredKind returns the gatherKind of a kind whose Go types bestiectl
+// does not link, such as those of the Gateway API and cert-manager.
+func unstructuredKind(gvk schema.GroupVersionKind) gatherKind {
+	return gatherKind{gvk, func(ctx context.Context, c *cli, ns string, selector labels.Set) (runtime.Object, error) {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		return list, c.client.List(ctx, list, client.InNamespace(ns), client.MatchingLabels(selector))
+	}}
+}
+
+// gather writes a support bundle of the Bestie named in args: the Bestie,
+// its objects with their status, the related Events, the logs of the app and
+// migration Job, and the logs and version of the operator. Secret values are
+// redacted. Anything that cannot be collected is listed in errors.txt
+// rather than failing the whole bundle.
+func (c *cli) gather(ctx context.Context, args []string, o *gatherOptions) error {
+	name, err := oneName(args)
+	if err != nil {
+		return err
+	}
+	bestie, err := c.pets.PetsV1().Besties(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	bestie.SetGroupVersionKind(petsv1.GroupVersion.WithKind("Bestie"))
+	comps, err := c.components(ctx, bestie)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	root := fmt.Sprintf("bestie-%s-%s-%s", bestie.Namespace, bestie.Name, now.Format("20060102-150405"))
+	output := o.output
+	if output == "" {
+		output = root + ".tar.gz"
+	}
+	var w io.Writer = c.out
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	b := newBundle(w, root, now)
+
+	if err := b.addObject("bestie.yaml", bestie); err != nil {
+		return err
+	}
+	summary := &bytes.Buffer{}
+	sc := *c
+	sc.out = summary
+	if err := sc.status(ctx, args); err != nil {
+		b.errorf("summary: %v", err)
+	}
+	if err := b.add("summary.txt", summary.Bytes()); err != nil {
+		return err
+	}
+
+	uids := map[types.UID]bool{bestie.UID: true}
+	if err := c.gatherObjects(ctx, b, bestie, comps, uids); err != nil {
+		return err
+	}
+	if err := c.gatherEvents(ctx, b, bestie.Namespace, uids); err != nil {
+		return err
+	}
+
+	opts := podLogOptions(o.tail, o.since)
+	pods, err := c.workloadPods(ctx, bestie.Namespace, comps)
+	if err != nil {
+		b.errorf("app pods: %v", err)
+	}
+	for i := range pods {
+		if err := c.gatherLogs(ctx, b, "logs", &pods[i], opts); err != nil {
+			return err
+		}
+	}
+	if err := c.gatherOperator(ctx, b, o.operatorNamespace, opts); err != nil {
+		return err
+	}
+
+	if err := b.close(); err != nil {
+		return err
+	}
+	if output != "-" {
+		fmt.Fprintf(c.out, "support bundle of bestie/%s written to %s\n", name, output)
+	}
+	return nil
+}
+
+// gatherObjects adds every object labelled with the Bestie instance, plus
+// the app and migration Job pods, which only carry the labels of their
+// manifest, and records their UIDs.
+func (c *cli) gatherObjects(ctx context.Context, b *bundle, bestie *petsv1.Bestie, comps *components, uids map[types.UID]bool) error {
+	instance := labels.Set{
+		controllers.LabelManagedBy: controllers.ManagedByValue,
+		controllers.LabelInstance:  bestie.Name,
+	}
+	add := func(gvk schema.GroupVersionKind, obj runtime.Object) error {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		if uids[accessor.GetUID()] && accessor.GetUID() != "" {
+			return nil
+		}
+		uids[accessor.GetUID()] = true
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+		return b.addObject(path.Join("objects", strings.ToLower(gvk.Kind), accessor.GetName()+".yaml"), obj)
+	}
+
+	for _, kind := range gatherKinds {
+		list, err := kind.list(ctx, c, bestie.Namespace, instance)
+		if err != nil {
+			if !meta.IsNoMatchError(err) {
+				b.errorf("list %s: %v", kind.gvk.Kind, err)
+			}
+			continue
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := add(kind.gvk, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	pods, err := c.workloadPods(ctx, bestie.Namespace, comps)
+	if err != nil {
+		b.errorf("app pods: %v", err)
+	}
+	for i := range pods {
+		if err := add(corev1.SchemeGroupVersion.WithKind("Pod"), &pods[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gatherEvents adds the Events of the objects whose UID is in uids, oldest
+// first.
+func (c *cli) gatherEvents(ctx context.Context, b *bundle, namespace string, uids map[types.UID]bool) error {
+	events, err := c.kube.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		b.errorf("list events: %v", err)
+		return nil
+	}
+	related := &corev1.EventList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "EventList"}}
+	for _, event := range events.Items {
+		if event.InvolvedObject.UID != "" && uids[event.InvolvedObject.UID] {
+			related.Items = append(related.Items, event)
+		}
+	}
+	sort.SliceStable(related.Items, func(i, j int) bool {
+		return eventTime(&related.Items[i]).Before(eventTime(&related.Items[j]))
+	})
+	return b.addObject("events.yaml", related)
+}
+
+// eventTime returns when event was last seen.
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+// gatherLogs adds the logs of every container of pod under dir, and those
+// of the previous instance of restarted containers.
+func (c *cli) gatherLogs(ctx context.Context, b *bundle, dir string, pod *corev1.Pod, opts corev1.PodLogOptions) error {
+	restarted := map[string]bool{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		restarted[status.Name] = status.RestartCount > 0
+	}
+	for _, container := range containerNames(pod) {
+		opts.Container = container
+		opts.Previous = false
+		if err := c.gatherContainerLogs(ctx, b, path.Join(dir, pod.Name, container+".log"), pod, opts); err != nil {
+			return err
+		}
+		if restarted[container] {
+			opts.Previous = true
+			if err := c.gatherContainerLogs(ctx, b, path.Join(dir, pod.Name, container+".previous.log"), pod, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *cli) gatherContainerLogs(ctx context.Context, b *bundle, name string, pod *corev1.Pod, opts corev1.PodLogOptions) error {
+	logs := &bytes.Buffer{}
+	if err := c.containerLogs(ctx, pod, opts, logs, ""); err != nil {
+		b.errorf("logs of %s/%s: %v", pod.Name, opts.Container, err)
+		return nil
+	}
+	return b.add(name, logs.Bytes())
+}
+
+// gatherOperator adds the Deployment, version and logs of every operator
+// Deployment in namespace, or in every namespace when it is empty.
+func (c *cli) gatherOperator(ctx context.Context, b *bundle, namespace string, opts corev1.PodLogOptions) error {
+	deployments, err := c.kube.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "metadata.name=" + operatorDeployment,
+	})
+	if err != nil {
+		b.errorf("list operator deployments: %v", err)
+		return nil
+	}
+	found := false
+	for i := range deployments.Items {
+		dp := &deployments.Items[i]
+		if dp.Name != operatorDeployment {
+			continue
+		}
+		found = true
+		dir := path.Join("operator", dp.Namespace)
+		dp.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+		if err := b.addObject(path.Join(dir, "deployment.yaml"), dp); err != nil {
+			return err
+		}
+		if err := b.add(path.Join(dir, "version.txt"), operatorVersion(dp)); err != nil {
+			return err
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(dp.Spec.Selector)
+		if err != nil {
+			return err
+		}
+		pods, err := c.kube.CoreV1().Pods(dp.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			b.errorf("list operator pods: %v", err)
+			continue
+		}
+		for j := range pods.Items {
+			if err := c.gatherLogs(ctx, b, path.Join(dir, "logs"), &pods.Items[j], opts); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		b.errorf("no %s Deployment found, pass --operator-namespace if it cannot be listed cluster-wide", operatorDeployment)
+	}
+	return nil
+}
+
+// operatorVersion describes the version of the operator Deployment dp runs:
+// its container images and, when installed by OLM, its ClusterServiceVersion.
+func operatorVersion(dp *appsv1.Deployment) []byte {
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "Deployment: %s/%s\n", dp.Namespace, dp.Name)
+	if csv := dp.Labels["olm.owner"]; csv != "" {
+		fmt.Fprintf(out, "ClusterServiceVersion: %s\n", csv)
+	}
+	for _, container := range dp.Spec.Template.Spec.Containers {
+		fmt.Fprintf(out, "Image (%s): %s\n", container.Name, container.Image)
+	}
+	return out.Bytes()
+}
+
+// bundle writes the files of a support bundle into a gzipped tarball, all
+// under a root directory.
+type bundle struct {
+	gz     *gzip.Writer
+	tw     *tar.Writer
+	root   string
+	now    time.Time
+	errors []string
+}
+
+func newBundle(w io.Writer, root string, now time.Time) *bundle {
+	gz := gzip.NewWriter(w)
+	return &bundle{gz: gz, tw: tar.NewWriter(gz), root: root, now: now}
+}
+
+// add adds a file with the given content.
+func (b *bundle) add(name string, content []byte) error {
+	if err := b.tw.WriteHeader(&tar.Header{
+		Name:    path.Join(b.root, name),
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: b.now,
+	}); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(content)
+	return err
+}
+
+// addObject adds obj as a YAML file, with secret values redacted and
+// managed fields dropped.
+func (b *bundle) addObject(name string, obj runtime.Object) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	redact(content)
+	out, err := yaml.Marshal(content)
+	if err != nil {
+		return err
+	}
+	return b.add(name, out)
+}
+
+// errorf records something that could not be collected.
+func (b *bundle) errorf(format string, args ...interface{}) {
+	b.errors = append(b.errors, fmt.Sprintf(format, args...))
+}
+
+// close adds errors.txt, if anything failed, and flushes the tarball.
+func (b *bundle) close() error {
+	if len(b.errors) > 0 {
+		if err := b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+// redact drops the values of Secrets and of environment variables whose
+// name suggests a secret, along with managed fields and the last applied
+// configuration, which may repeat them.
+func redact(obj map[string]interface{}) {
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, corev1.LastAppliedConfigAnnotation)
+		}
+	}
+	if obj["kind"] == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			if values, ok := obj[field].(map[string]interface{}); ok {
+				for key := range values {
+					values[key] = redacted
+				}
+			}
+		}
+	}
+	redactEnv(obj)
+}
+
+// redactEnv walks value and redacts every env entry with a sensitive name.
+func redactEnv(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if env, ok := v["env"].([]interface{}); ok {
+			for _, entry := range env {
+				if e, ok := entry.(map[string]interface{}); ok {
+					if name, _ := e["name"].(string); sensitive(name) {
+						if _, ok := e["value"]; ok {
+							e["value"] = redacted
+						}
+					}
+				}
+			}
+		}
+		for _, child := range v {
+			redactEnv(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			redactEnv(child)
+		}
+	}
+}
+
+// sensitive returns whether an environment variable named name likely holds
+// a secret.
+func sensitive(name string) bool {
+	name = strings.ToUpper(name)
+	for _, word := range []string{"PASSWORD", "SECRET", "TOKEN", "KEY", "CREDENTIAL"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
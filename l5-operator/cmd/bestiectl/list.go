@@ -0,0 +1,92 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+var listCommand = command{
+	name:  "list",
+	usage: "list [flags]",
+	short: "List Besties with the readiness of each component",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		var allNamespaces bool
+		fs.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List the Besties of every namespace.")
+		return func(ctx context.Context, args []string) error { return c.list(ctx, args, allNamespaces) }
+	},
+}
+
+func (c *cli) list(ctx context.Context, args []string, allNamespaces bool) error {
+	if len(args) > 0 {
+		return errors.New("list takes no arguments")
+	}
+	ns := c.namespace
+	if allNamespaces {
+		ns = metav1.NamespaceAll
+	}
+	besties, err := c.pets.PetsV1().Besties(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if len(besties.Items) == 0 {
+		fmt.Fprintln(c.errOut, "No Besties found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 3, ' ', 0)
+	if allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tAPP\tDATABASE\tMIGRATION\tEXPOSE\tSTATUS\tAGE")
+	for i := range besties.Items {
+		bestie := &besties.Items[i]
+		comps, err := c.components(ctx, bestie)
+		if err != nil {
+			return err
+		}
+		if allNamespaces {
+			fmt.Fprintf(w, "%s\t", bestie.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			bestie.Name,
+			comps.appReadiness(),
+			comps.databaseReadiness(),
+			comps.migrationState(),
+			comps.exposure(),
+			phase(bestie),
+			age(bestie.CreationTimestamp),
+		)
+	}
+	return w.Flush()
+}
+
+// age returns how long ago t was, the way kubectl prints it.
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
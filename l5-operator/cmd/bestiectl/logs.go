@@ -0,0 +1,161 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var logsCommand = command{
+	name:  "logs",
+	usage: "logs NAME [flags]",
+	short: "Print the logs of the app and migration Job of a Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		o := &logsOptions{}
+		fs.Int64Var(&o.tail, "tail", -1, "Number of recent lines to print per container. All lines when negative.")
+		fs.DurationVar(&o.since, "since", 0, "Only print lines newer than this duration, e.g. 1h.")
+		return func(ctx context.Context, args []string) error { return c.logs(ctx, args, o) }
+	},
+}
+
+type logsOptions struct {
+	tail  int64
+	since time.Duration
+}
+
+// logs prints the logs of every container, init containers included, of the
+// app and migration Job pods, each line prefixed with its pod and container.
+func (c *cli) logs(ctx context.Context, args []string, o *logsOptions) error {
+	name, err := oneName(args)
+	if err != nil {
+		return err
+	}
+	bestie, err := c.pets.PetsV1().Besties(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	comps, err := c.components(ctx, bestie)
+	if err != nil {
+		return err
+	}
+
+	pods, err := c.workloadPods(ctx, bestie.Namespace, comps)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("bestie/%s has no app or migration Job pods yet", name)
+	}
+
+	opts := podLogOptions(o.tail, o.since)
+	for i := range pods {
+		pod := &pods[i]
+		for _, container := range containerNames(pod) {
+			opts.Container = container
+			prefix := fmt.Sprintf("[%s/%s] ", pod.Name, container)
+			if err := c.containerLogs(ctx, pod, opts, c.out, prefix); err != nil {
+				// Containers that have not started have no logs yet;
+				// keep going with the others.
+				fmt.Fprintf(c.errOut, "warning: %s/%s: %v\n", pod.Name, container, err)
+			}
+		}
+	}
+	return nil
+}
+
+// workloadPods returns the pods of the app Deployment, then those of the
+// migration Job, each sorted by name.
+func (c *cli) workloadPods(ctx context.Context, namespace string, comps *components) ([]corev1.Pod, error) {
+	var selectors []labels.Selector
+	if comps.app != nil {
+		selector, err := metav1.LabelSelectorAsSelector(comps.app.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	if comps.job != nil {
+		// The Job controller labels the pods of a Job with its name.
+		selectors = append(selectors, labels.SelectorFromSet(labels.Set{"job-name": comps.job.Name}))
+	}
+
+	var all []corev1.Pod
+	for _, selector := range selectors {
+		pods, err := c.kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+		all = append(all, pods.Items...)
+	}
+	return all, nil
+}
+
+// podLogOptions returns the options reading the last tail lines, all of them
+// when negative, written within since, or ever when zero.
+func podLogOptions(tail int64, since time.Duration) corev1.PodLogOptions {
+	opts := corev1.PodLogOptions{}
+	if tail >= 0 {
+		opts.TailLines = &tail
+	}
+	if since > 0 {
+		seconds := int64(since.Seconds())
+		opts.SinceSeconds = &seconds
+	}
+	return opts
+}
+
+// containerNames returns the init containers of pod, then its containers.
+func containerNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, container := range pod.Spec.InitContainers {
+		names = append(names, container.Name)
+	}
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
+
+// containerLogs copies the logs of the container opts names to w, each line
+// prefixed with prefix.
+func (c *cli) containerLogs(ctx context.Context, pod *corev1.Pod, opts corev1.PodLogOptions, w io.Writer, prefix string) error {
+	stream, err := c.kube.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if _, err := fmt.Fprintf(w, "%s%s\n", prefix, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command bestiectl runs day-2 operations against Bestie instances: it
+// creates them, summarizes the state of every component, triggers database
+// backups and restores, pauses reconciliation and collects logs.
+//
+// Installed on the PATH as kubectl-bestie, e.g. through the bin/kubectl-bestie
+// link `make bestiectl` creates, it also runs as the "kubectl bestie" plugin.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// so every kubeconfig kubectl accepts works here too.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func main() {
+	c := &cli{
+		out:          os.Stdout,
+		errOut:       os.Stderr,
+		loadingRules: clientcmd.NewDefaultClientConfigLoadingRules(),
+	}
+	if err := c.run(context.Background(), programName(os.Args[0]), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// programName returns how the user invoked bestiectl, for the usage text.
+func programName(arg0 string) string {
+	if filepath.Base(arg0) == "kubectl-bestie" {
+		return "kubectl bestie"
+	}
+	return "bestiectl"
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+)
+
+var pauseCommand = command{
+	name:  "pause",
+	usage: "pause NAME [flags]",
+	short: "Stop the operator from changing the objects of a Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		return func(ctx context.Context, args []string) error { return c.setPaused(ctx, args, true) }
+	},
+}
+
+var resumeCommand = command{
+	name:  "resume",
+	usage: "resume NAME [flags]",
+	short: "Resume the reconciliation of a paused Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		return func(ctx context.Context, args []string) error { return c.setPaused(ctx, args, false) }
+	},
+}
+
+var restartCommand = command{
+	name:  "restart",
+	usage: "restart NAME [flags]",
+	short: "Restart the app pods of a Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		return func(ctx context.Context, args []string) error { return c.restart(ctx, args, time.Now()) }
+	},
+}
+
+// restart sets the bestie.com/restartedAt annotation of the Bestie named in
+// args to now, which the operator propagates to the app pod template.
+func (c *cli) restart(ctx context.Context, args []string, now time.Time) error {
+	name, err := oneName(args)
+	if err != nil {
+		return err
+	}
+	patch := map[string]interface{}{"metadata": map[string]interface{}{
+		"annotations": map[string]interface{}{petsv1.RestartedAtAnnotation: now.UTC().Format(time.RFC3339)},
+	}}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	if _, err := c.pets.PetsV1().Besties(c.namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "bestie/%s restarted\n", name)
+	return nil
+}
+
+// setPaused sets spec.paused of the Bestie named in args. Resuming also drops
+// the bestie.com/paused annotation, which would keep the Bestie paused.
+func (c *cli) setPaused(ctx context.Context, args []string, paused bool) error {
+	name, err := oneName(args)
+	if err != nil {
+		return err
+	}
+	patch := map[string]interface{}{"spec": map[string]interface{}{"paused": paused}}
+	if !paused {
+		patch["metadata"] = map[string]interface{}{
+			"annotations": map[string]interface{}{petsv1.PausedAnnotation: nil},
+		}
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	if _, err := c.pets.PetsV1().Besties(c.namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	if paused {
+		fmt.Fprintf(c.out, "bestie/%s paused\n", name)
+	} else {
+		fmt.Fprintf(c.out, "bestie/%s resumed\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var statusCommand = command{
+	name:  "status",
+	usage: "status NAME [flags]",
+	short: "Show the conditions, URL, database health and last backup of a Bestie",
+	setup: func(c *cli, fs *pflag.FlagSet) func(context.Context, []string) error {
+		return func(ctx context.Context, args []string) error { return c.status(ctx, args) }
+	},
+}
+
+func (c *cli) status(ctx context.Context, args []string) error {
+	name, err := oneName(args)
+	if err != nil {
+		return err
+	}
+	bestie, err := c.pets.PetsV1().Besties(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	comps, err := c.components(ctx, bestie)
+	if err != nil {
+		return err
+	}
+
+	url := comps.url()
+	if url == "" {
+		url = "<none>"
+	}
+	lastBackup := "<none>"
+	if backup := comps.lastBackup(); backup != nil {
+		lastBackup = fmt.Sprintf("%s (%s, %s ago)", backup.completed.UTC().Format(time.RFC3339), backup.kind, age(backup.completed))
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", bestie.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", bestie.Namespace)
+	fmt.Fprintf(w, "Agency:\t%s\n", bestie.Spec.AgencyName)
+	fmt.Fprintf(w, "Status:\t%s\n", phase(bestie))
+	fmt.Fprintf(w, "URL:\t%s\n", url)
+	fmt.Fprintf(w, "Exposed by:\t%s\n", comps.exposure())
+	fmt.Fprintf(w, "App:\t%s ready\n", comps.appReadiness())
+	fmt.Fprintf(w, "Migration:\t%s\n", comps.migrationState())
+	fmt.Fprintf(w, "Database:\t%s\n", comps.databaseHealth())
+	fmt.Fprintf(w, "Last backup:\t%s\n", lastBackup)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out, "Conditions:")
+	if len(bestie.Status.Conditions) == 0 {
+		fmt.Fprintln(c.out, "  <none>")
+		return nil
+	}
+	w = tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tAGE\tMESSAGE")
+	for _, cond := range bestie.Status.Conditions {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, age(cond.LastTransitionTime), cond.Message)
+	}
+	return w.Flush()
+}
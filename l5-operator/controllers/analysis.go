@@ -0,0 +1,150 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// errNoMetrics is returned by analyzeRollout when there is nothing to compare
+// the new version by.
+var errNoMetrics = errors.New("the analysis found no metrics of the new version")
+
+// MetricsClient runs the queries of the rollout analysis. ok is false when
+// the query returns no data.
+type MetricsClient interface {
+	Query(ctx context.Context, query string, at time.Time) (value float64, ok bool, err error)
+}
+
+// newMetricsClient returns the client of the metrics API at address.
+func newMetricsClient(address, bearerToken string) MetricsClient {
+	c := prometheus.NewClient(address)
+	c.BearerToken = bearerToken
+	return c
+}
+
+// metricsClient returns the client of the metrics API the rollout of
+// bestie is analysed with.
+func (r *BestieReconciler) metricsClient(ctx context.Context, bestie *petsv2.Bestie) (MetricsClient, error) {
+	analysis := bestie.Spec.Rollout.Analysis
+	var token string
+	if ref := analysis.BearerTokenSecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.reader().Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: bestie.Namespace}, secret); err != nil {
+			return nil, err
+		}
+		value, found := secret.Data[ref.Key]
+		if !found {
+			return nil, fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+		token = strings.TrimSpace(string(value))
+	}
+	if r.NewMetricsClient == nil {
+		return newMetricsClient(analysis.Address, token), nil
+	}
+	return r.NewMetricsClient(analysis.Address, token), nil
+}
+
+// analyzeRollout compares the error rate and the latency of the canary
+// Service with those of the bestie Service over the analysis interval
+// ending at now. It returns why the new version does worse, or otherwise a
+// summary of the metrics. Missing metrics, e.g. without traffic, are
+// inconclusive and return errNoMetrics.
+func (r *BestieReconciler) analyzeRollout(ctx context.Context, bestie *petsv2.Bestie, now time.Time) (reason, summary string, err error) {
+	analysis := bestie.Spec.Rollout.Analysis
+	c, err := r.metricsClient(ctx, bestie)
+	if err != nil {
+		return "", "", err
+	}
+	interval := analysis.EffectiveInterval(bestie.Spec.Rollout.EffectiveStepDuration())
+	measure := func(query string) (stable, canary float64, ok bool, err error) {
+		var stableOK, canaryOK bool
+		if stable, stableOK, err = runQuery(ctx, c, query, bestie, bestie.Name+"-service", interval, now); err != nil {
+			return 0, 0, false, err
+		}
+		if canary, canaryOK, err = runQuery(ctx, c, query, bestie, bestie.Name+"-service-canary", interval, now); err != nil {
+			return 0, 0, false, err
+		}
+		return stable, canary, stableOK && canaryOK, nil
+	}
+
+	var results []string
+	stable, canary, ok, err := measure(analysis.EffectiveErrorRateQuery())
+	if err != nil {
+		return "", "", err
+	}
+	if ok {
+		maxIncrease := petsv2.DefaultMaxErrorRateIncrease
+		if analysis.MaxErrorRateIncrease != nil {
+			maxIncrease = *analysis.MaxErrorRateIncrease
+		}
+		if canary-stable > float64(maxIncrease)/100 {
+			return fmt.Sprintf("the error rate of the new version is %.2f%% against %.2f%% for the current one", canary*100, stable*100), "", nil
+		}
+		results = append(results, fmt.Sprintf("error rate %.2f%% against %.2f%%", canary*100, stable*100))
+	}
+
+	stable, canary, ok, err = measure(analysis.EffectiveLatencyQuery())
+	if err != nil {
+		return "", "", err
+	}
+	if ok && stable > 0 {
+		maxIncrease := petsv2.DefaultMaxLatencyIncrease
+		if analysis.MaxLatencyIncrease != nil {
+			maxIncrease = *analysis.MaxLatencyIncrease
+		}
+		if canary > stable*(1+float64(maxIncrease)/100) {
+			return fmt.Sprintf("the latency of the new version is %s against %s for the current one", seconds(canary), seconds(stable)), "", nil
+		}
+		results = append(results, fmt.Sprintf("latency %s against %s", seconds(canary), seconds(stable)))
+	}
+
+	if len(results) == 0 {
+		return "", "", errNoMetrics
+	}
+	return "", "The new version passed the analysis: " + strings.Join(results, ", "), nil
+}
+
+// runQuery runs the query template for the Service of bestie.
+func runQuery(ctx context.Context, c MetricsClient, query string, bestie *petsv2.Bestie, service string, interval time.Duration, at time.Time) (float64, bool, error) {
+	t, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return 0, false, err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, struct {
+		Namespace, Service, Interval string
+	}{bestie.Namespace, service, fmt.Sprintf("%ds", int64(interval/time.Second))}); err != nil {
+		return 0, false, err
+	}
+	return c.Query(ctx, b.String(), at)
+}
+
+// seconds formats a duration in seconds.
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
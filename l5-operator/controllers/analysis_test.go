@@ -0,0 +1,143 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakePrometheus serves the error rates and latencies of the bestie and
+// canary Services; a missing value is a query without result.
+type fakePrometheus struct {
+	errorRates map[string]string
+	latencies  map[string]string
+	queries    []string
+	token      string
+}
+
+func (p *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.FormValue("query")
+	p.queries = append(p.queries, query)
+	p.token = r.Header.Get("Authorization")
+	values := p.latencies
+	if strings.Contains(query, "haproxy_server_http_responses_total") {
+		values = p.errorRates
+	}
+	service := "bestie-service"
+	if strings.Contains(query, `service="bestie-service-canary"`) {
+		service = "bestie-service-canary"
+	}
+	result := "[]"
+	if value, ok := values[service]; ok {
+		result = fmt.Sprintf(`[{"metric":{},"value":[%d,%q]}]`, time.Now().Unix(), value)
+	}
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+}
+
+func TestAnalyzeRollout(t *testing.T) {
+	tests := []struct {
+		name       string
+		errorRates map[string]string
+		latencies  map[string]string
+		wantReason string
+		wantSum    string
+		wantErr    error
+	}{
+		{
+			name:       "passes",
+			errorRates: map[string]string{"bestie-service": "0.01", "bestie-service-canary": "0.015"},
+			latencies:  map[string]string{"bestie-service": "0.2", "bestie-service-canary": "0.22"},
+			wantSum:    "error rate 1.50% against 1.00%, latency 220ms against 200ms",
+		},
+		{
+			name:       "more errors",
+			errorRates: map[string]string{"bestie-service": "0.01", "bestie-service-canary": "0.05"},
+			latencies:  map[string]string{"bestie-service": "0.2", "bestie-service-canary": "0.2"},
+			wantReason: "the error rate of the new version is 5.00% against 1.00% for the current one",
+		},
+		{
+			name:       "slower",
+			errorRates: map[string]string{"bestie-service": "0", "bestie-service-canary": "0"},
+			latencies:  map[string]string{"bestie-service": "0.2", "bestie-service-canary": "0.3"},
+			wantReason: "the latency of the new version is 300ms against 200ms for the current one",
+		},
+		{
+			name:       "no traffic",
+			errorRates: map[string]string{"bestie-service": "0.01"},
+			latencies:  map[string]string{"bestie-service": "0.2"},
+			wantErr:    errNoMetrics,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "prometheus-token", Namespace: "pets"},
+		Data:       map[string][]byte{"token": []byte("secret\n")},
+	}
+	r := &BestieReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(token).Build(), Scheme: scheme}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			prometheus := &fakePrometheus{errorRates: tt.errorRates, latencies: tt.latencies}
+			server := httptest.NewServer(prometheus)
+			defer server.Close()
+
+			bestie := &petsv2.Bestie{
+				ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets"},
+				Spec: petsv2.BestieSpec{Rollout: petsv2.RolloutSpec{
+					Strategy:     petsv2.RolloutCanary,
+					StepDuration: &metav1.Duration{Duration: 2 * time.Minute},
+					Analysis: &petsv2.AnalysisSpec{
+						Address: server.URL,
+						BearerTokenSecretRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "prometheus-token"},
+							Key:                  "token",
+						},
+					},
+				}},
+			}
+			reason, summary, err := r.analyzeRollout(context.Background(), bestie, time.Now())
+			if tt.wantErr != nil {
+				g.Expect(err).To(MatchError(tt.wantErr))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(reason).To(Equal(tt.wantReason))
+			if tt.wantSum != "" {
+				g.Expect(summary).To(ContainSubstring(tt.wantSum))
+			}
+			g.Expect(prometheus.token).To(Equal("Bearer secret"))
+			g.Expect(prometheus.queries[0]).To(ContainSubstring(`{namespace="pets",service="bestie-service",code="5xx"}[120s]`))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// reconcileAutoscaler creates or updates the HorizontalPodAutoscaler of the
+// app while autoscaling is active and removes it otherwise, handing the
+// replica count back to spec.app.replicas.
+func (r *BestieReconciler) reconcileAutoscaler(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, active bool) error {
+	if !active {
+		return r.removeComponent(ctx, bestie, "HorizontalPodAutoscaler", &autoscalingv2.HorizontalPodAutoscaler{}, "-hpa")
+	}
+
+	return r.reconcileDesired(ctx, req, bestie, desiredAutoscaler(bestie))
+}
+
+// desiredAutoscaler returns the autoscaler of the app of bestie.
+func desiredAutoscaler(bestie *petsv2.Bestie) component {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	return component{kind: "HorizontalPodAutoscaler", obj: hpa, suffix: "-hpa", manifest: autoscalerManifest, mutate: func() error {
+		setAutoscaler(hpa, bestie)
+		return nil
+	}}
+}
+
+// setAutoscaler sets the bounds and CPU target of the app autoscaler from
+// spec.app.autoscaling.
+func setAutoscaler(hpa *autoscalingv2.HorizontalPodAutoscaler, bestie *petsv2.Bestie) {
+	as := bestie.Spec.App.Autoscaling
+	minReplicas := petsv2.DefaultMinReplicas
+	if as.MinReplicas != nil {
+		minReplicas = *as.MinReplicas
+	}
+	target := petsv2.DefaultTargetCPUUtilizationPercentage
+	if as.TargetCPUUtilizationPercentage != nil {
+		target = *as.TargetCPUUtilizationPercentage
+	}
+	hpa.Spec.MinReplicas = &minReplicas
+	hpa.Spec.MaxReplicas = as.MaxReplicas
+	hpa.Spec.Metrics = []autoscalingv2.MetricSpec{{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: "cpu",
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: &target,
+			},
+		},
+	}}
+}
+
+// autoscaledReplicas returns the replica count of the app Deployment while
+// the autoscaler owns it: the autoscaler's current choice, or the given
+// replicas when the app is created or starts from zero, e.g. after
+// maintenance or hibernation.
+func autoscaledReplicas(dp *appsv1.Deployment, replicas int32) int32 {
+	if !dp.CreationTimestamp.IsZero() && dp.Spec.Replicas != nil && *dp.Spec.Replicas > 0 {
+		return *dp.Spec.Replicas
+	}
+	return replicas
+}
@@ -19,22 +19,33 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 
-	//"time"
 	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
-	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	configv1alpha1 "github.com/opdev/l5-operator-demo/l5-operator/api/config/v1alpha1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/platform"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/tracing"
 	routev1 "github.com/openshift/api/route/v1"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
-	batchv1 "k8s.io/api/batch/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var log = ctrllog.Log.WithName("controller_bestie")
@@ -43,11 +54,38 @@ var log = ctrllog.Log.WithName("controller_bestie")
 type BestieReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Tracer records a span per reconcile and per component. It defaults to
+	// the global operator tracer, which is a no-op unless tracing is enabled.
+	Tracer trace.Tracer
+	// Defaults are the operator-wide defaults loaded from the component config.
+	Defaults configv1alpha1.BestieDefaults
+	// Platform lists the optional APIs of the cluster. Objects of APIs the
+	// cluster does not serve are neither rendered nor watched.
+	Platform platform.Platform
+	// APIReader reads objects the cache leaves out, like Secrets the operator
+	// did not label. It defaults to the client.
+	APIReader client.Reader
+	// Controller tunes the concurrency and retries of the controller.
+	Controller ControllerOptions
+	// NewMetricsClient returns the client of the metrics API the rollouts
+	// are analysed with. It defaults to a Prometheus client.
+	NewMetricsClient func(address, bearerToken string) MetricsClient
+
+	// waits holds the backoff of Besties waiting for their app or database.
+	waits backoff
 }
 
 //+kubebuilder:rbac:groups=pets.bestie.com,resources=besties,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=pets.bestie.com,resources=besties/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=pets.bestie.com,resources=besties/finalizers,verbs=update
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=postgres-operator.crunchydata.com,resources=postgresclusters,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -58,124 +96,339 @@ type BestieReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.10.0/pkg/reconcile
-func (r *BestieReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *BestieReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := r.tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		tracing.BestieNameKey.String(req.Name),
+		tracing.BestieNamespaceKey.String(req.Namespace),
+	))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	log := ctrllog.FromContext(ctx)
 	log.Info("Reconciling Bestie")
 
 	// Fetch the Bestie instance
-	bestie := &petsv1.Bestie{}
-	err := r.Get(ctx, req.NamespacedName, bestie)
+	bestie := &petsv2.Bestie{}
+	err = r.Get(ctx, req.NamespacedName, bestie)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			log.Info("Bestie resource not found. Ignoring since object must be deleted")
+			r.waits.reset(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		log.Error(err, "Failed to get Bestie")
 		return ctrl.Result{}, err
 	}
+	span.SetAttributes(tracing.BestieGenerationKey.Int64(bestie.Generation))
+
+	if bestie.IsPaused() {
+		// Leave every object as it is, e.g. while it is hand-edited during an
+		// incident, but keep the status current.
+		log.Info("Bestie is paused, skipping reconciliation")
+		r.waits.reset(req.NamespacedName)
+		return ctrl.Result{}, r.updateStatus(ctx, bestie)
+	}
+
+	// Refresh the status on the way out, whatever the outcome of this pass.
+	defer func() {
+		if statusErr := r.updateStatus(ctx, bestie); statusErr != nil && err == nil {
+			err = statusErr
+		}
+	}()
 
-	//var result *reconcile.Result
+	now := time.Now()
+	hibernating, nextTransition, err := hibernationState(bestie, now)
+	if err != nil {
+		log.Error(err, "Invalid hibernation schedule")
+		return ctrl.Result{}, err
+	}
+	var untilTransition time.Duration
+	if !nextTransition.IsZero() {
+		untilTransition = nextTransition.Sub(now)
+	}
 
 	// reconcile Postgres
-	pgo := &pgov1.PostgresCluster{}
+	if err := r.reconcileDesired(ctx, req, bestie, r.desiredPostgresCluster(bestie, hibernating)); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if err := r.reconcileNetworkPolicies(ctx, req, bestie); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
 
-	err = r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-pgo", Namespace: bestie.Namespace}, pgo)
+	database, err := r.databaseReadiness(ctx, bestie)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new PGC for bestie")
-			fileName := "config/resources/postgrescluster.yaml"
-			r.applyManifests(ctx, req, bestie, pgo, fileName)
-		} else {
-			return ctrl.Result{Requeue: true}, err
-		}
-		// TODO: should we update then?
+		return ctrl.Result{Requeue: true}, err
 	}
+	databaseReady := database.Status == metav1.ConditionTrue
 
-	// reconcile Deployment
-	dp := &appsv1.Deployment{}
+	credentials, err := r.reconcileCredentialRotation(ctx, req, bestie, databaseReady && !hibernating, now)
+	if err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
 
-	err = r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-app", Namespace: bestie.Namespace}, dp)
+	maintenance := bestie.Spec.Maintenance.Enabled && !hibernating
+	rollingOut := r.rollingOut(bestie, maintenance, hibernating)
+	canary, err := r.canaryDeployment(ctx, bestie)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new app for bestie")
-			fileName := "config/resources/bestie-deploy.yaml"
-			r.applyManifests(ctx, req, bestie, dp, fileName)
-		} else {
-			return ctrl.Result{Requeue: true}, err
-		}
-		// TODO: should we update then?
+		return ctrl.Result{Requeue: true}, err
 	}
 
-	//isApprunning
-	bestieRunning := r.isRunning(ctx, bestie)
+	// reconcile Deployment. The app is only deployed once its database is
+	// ready, so that it never starts without one.
+	app := r.desiredAppDeployment(ctx, bestie, hibernating, databaseReady)
+	dp := app.obj.(*appsv1.Deployment)
+	if !databaseReady {
+		if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-app", Namespace: bestie.Namespace}, dp); err != nil {
+			if !errors.IsNotFound(err) {
+				return ctrl.Result{Requeue: true}, err
+			}
+			delay := r.waitDelay(req)
+			log.Info(fmt.Sprintf("Waiting for the database before creating bestie-app, checking again in %s", delay), "reason", database.Reason)
+			return ctrl.Result{RequeueAfter: requeueAfter(delay, untilTransition)}, nil
+		}
+	}
+	// With the Canary and BlueGreen strategies, a changed pod template is
+	// rolled out next to the Deployment, which only takes it once promoted.
+	var appTemplate *corev1.PodTemplateSpec
+	setApp := app.mutate
+	app.mutate = func() error {
+		current := dp.Spec.Template.DeepCopy()
+		if err := setApp(); err != nil {
+			return err
+		}
+		if !credentials.rotating {
+			// Mid-rotation the user Secret has no password.
+			if err := r.stampConfigHash(ctx, bestie, &dp.Spec.Template); err != nil {
+				return err
+			}
+		}
+		appTemplate = dp.Spec.Template.DeepCopy()
+		if holdsAppTemplate(dp, canary, appTemplate, rollingOut) {
+			dp.Spec.Template = *current
+		}
+		return nil
+	}
+	if err := r.reconcileDesired(ctx, req, bestie, app); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
 
-	if !bestieRunning {
-		// If bestie-app isn't running yet, requeue the reconcile
-		// to run again after a delay
-		delay := time.Second * time.Duration(5)
+	if err := r.reconcileAutoscaler(ctx, req, bestie, bestie.Spec.App.Autoscaling.Enabled && !maintenance && !hibernating); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+	switch {
+	case hibernating:
+		log.Info("Bestie is hibernating", "until", nextTransition)
+	case maintenance:
+		if err := r.reconcileMaintenancePage(ctx, req, bestie); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	case !r.isRunning(ctx, bestie):
+		// If bestie-app isn't running yet, wait for the Deployment to
+		// report ready pods, polling with a backoff in case no event
+		// arrives. Traffic stays on the maintenance page, if any, until then.
+		delay := r.waitDelay(req)
 
 		log.Info(fmt.Sprintf("bestie-app isn't running, waiting for %s", delay))
-		return reconcile.Result{RequeueAfter: delay}, nil
+		return reconcile.Result{RequeueAfter: requeueAfter(delay, untilTransition)}, nil
+	}
+
+	if !maintenance && !hibernating {
+		// reconcile migration job
+		if err := r.reconcileDesired(ctx, req, bestie, r.desiredMigrationJob(bestie)); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
 	}
 
-	job := &batchv1.Job{}
+	// reconcile service. While hibernating it keeps selecting the app, whose
+	// pods only receive traffic again once they pass their readiness probe.
+	if err := r.reconcileDesired(ctx, req, bestie, r.desiredService(bestie, maintenance)); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
 
-	err = r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-job", Namespace: bestie.Namespace}, job)
+	rollout, err := r.reconcileRollout(ctx, req, bestie, appTemplate, rollingOut, now)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new job for bestie")
-			fileName := "config/resources/bestie-job.yaml"
-			r.applyManifests(ctx, req, bestie, job, fileName)
-		} else {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if err := r.reconcileCertificates(ctx, req, bestie); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	// reconcile route or ingress
+	if err := r.reconcileExposure(ctx, req, bestie, rollout.canaryWeight); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+	if rollout.done {
+		// Only once no traffic is sent to it anymore.
+		if err := r.removeCanary(ctx, bestie); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
+	if !maintenance {
+		if err := r.removeMaintenancePage(ctx, bestie); err != nil {
 			return ctrl.Result{Requeue: true}, err
 		}
-		// TODO: should we update then?
 	}
 
-	// reconcile service
+	if rollout.requeueAfter == 0 && !credentials.rotating {
+		r.waits.reset(req.NamespacedName)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter(r.Defaults.Requeue.Ready.Duration, untilTransition, rollout.requeueAfter, credentials.requeueAfter)}, nil
+}
+
+// waitDelay returns when to check the Bestie of req again while it waits for
+// its app or database, backing off from the AppNotReady interval up to
+// MaxBackoff.
+func (r *BestieReconciler) waitDelay(req ctrl.Request) time.Duration {
+	return r.waits.next(req.NamespacedName, r.Defaults.Requeue.AppNotReady.Duration, r.Defaults.Requeue.MaxBackoff.Duration)
+}
+
+// reconcileComponent creates obj from the manifest in fileName unless the
+// object named after the bestie plus suffix already exists. The optional
+// mutate func sets the fields the operator manages, both before obj is
+// created and on the existing object, which is updated when mutate changed
+// it. An existing object the cache misses because it lacks the operator's
+// labels is adopted. Each component gets its own span so slow steps show up
+// in the reconcile trace.
+func (r *BestieReconciler) reconcileComponent(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, component string, obj client.Object, suffix, fileName string, mutate func() error) (err error) {
+	ctx, span := r.tracer().Start(ctx, component, trace.WithAttributes(
+		tracing.BestieNameKey.String(bestie.Name),
+		tracing.BestieNamespaceKey.String(bestie.Namespace),
+		tracing.BestieGenerationKey.Int64(bestie.Generation),
+	))
+	defer func() { tracing.EndSpan(span, err) }()
 
-	svc := &corev1.Service{}
+	log := ctrllog.FromContext(ctx)
 
-	err = r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-service", Namespace: bestie.Namespace}, svc)
+	key := types.NamespacedName{Name: bestie.Name + suffix, Namespace: bestie.Namespace}
+	err = r.Get(ctx, key, obj)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new service for bestie")
-			fileName := "config/resources/bestie-svc.yaml"
-			r.applyManifests(ctx, req, bestie, svc, fileName)
-		} else {
-			return ctrl.Result{Requeue: true}, err
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		log.Info("Creating a new " + component + " for bestie")
+		err = r.applyManifests(ctx, req, bestie, obj, fileName, mutate)
+		if !errors.IsAlreadyExists(err) {
+			return err
 		}
-		// TODO: should we update then?
+		// The cache only holds labelled objects: this one was created
+		// without the operator's labels, e.g. by an older version.
+		log.Info("Adopting the existing " + component + " for bestie")
+		return r.adoptComponent(ctx, bestie, obj, key, mutate)
 	}
 
-	// reconcile route
+	if mutate == nil {
+		return nil
+	}
+	existing := obj.DeepCopyObject()
+	if err = mutate(); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(existing, obj) {
+		return nil
+	}
+	log.Info("Updating the " + component + " for bestie")
+	return r.Update(ctx, obj)
+}
 
-	route := &routev1.Route{}
+// component is an object of a Bestie as both Reconcile and Render build it:
+// it is loaded from manifest, then mutate sets the fields the operator
+// manages. kind names it in logs and traces.
+type component struct {
+	kind     string
+	obj      client.Object
+	suffix   string
+	manifest string
+	mutate   func() error
+}
 
-	err = r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-route", Namespace: bestie.Namespace}, route)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new route for bestie")
-			fileName := "config/resources/bestie-route.yaml"
-			r.applyManifests(ctx, req, bestie, route, fileName)
-		} else {
-			return ctrl.Result{Requeue: true}, err
+// reconcileDesired creates or updates the component c of bestie.
+func (r *BestieReconciler) reconcileDesired(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, c component) error {
+	return r.reconcileComponent(ctx, req, bestie, c.kind, c.obj, c.suffix, c.manifest, c.mutate)
+}
+
+// adoptComponent labels the object at key as an object of bestie, so that
+// the cache sees it from now on, and sets the fields mutate manages. obj is
+// read through the APIReader, as the cache does not hold it yet.
+func (r *BestieReconciler) adoptComponent(ctx context.Context, bestie *petsv2.Bestie, obj client.Object, key types.NamespacedName, mutate func() error) error {
+	// obj holds the rendered object, which must not leak into the existing
+	// one.
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	v := reflect.ValueOf(obj).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	if err := r.reader().Get(ctx, key, obj); err != nil {
+		return err
+	}
+
+	obj.SetLabels(mergeLabels(obj.GetLabels(), labelsFor(bestie)))
+	if err := controllerutil.SetControllerReference(bestie, obj, r.Scheme); err != nil {
+		return err
+	}
+	if mutate != nil {
+		if err := mutate(); err != nil {
+			return err
 		}
-		// TODO: should we update then?
 	}
+	return r.Update(ctx, obj)
+}
 
-	return ctrl.Result{}, nil
+// removeComponent deletes the object named after the bestie plus suffix, if
+// it exists, e.g. once the feature it belongs to has been turned off.
+func (r *BestieReconciler) removeComponent(ctx context.Context, bestie *petsv2.Bestie, component string, obj client.Object, suffix string) error {
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + suffix, Namespace: bestie.Namespace}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	ctrllog.FromContext(ctx).Info("Removing the " + component + " for bestie")
+	return client.IgnoreNotFound(r.Delete(ctx, obj))
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// reader returns the APIReader, or the client when it is not set.
+func (r *BestieReconciler) reader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
+
+func (r *BestieReconciler) tracer() trace.Tracer {
+	if r.Tracer == nil {
+		return tracing.Tracer()
+	}
+	return r.Tracer
+}
+
+// SetupWithManager sets up the controller with the Manager. Besides the
+// owned objects, it watches the PostgresCluster and the user Secret PGO
+// creates for it, so that readiness changes of the app and the database
+// trigger a reconcile.
 func (r *BestieReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&petsv1.Bestie{}).
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&petsv2.Bestie{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
-		Owns(&routev1.Route{}).
-		Complete(r)
+		Owns(&corev1.ConfigMap{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&pgov1.PostgresCluster{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(instanceOf)).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.Controller.MaxConcurrentReconciles,
+			RateLimiter:             r.Controller.rateLimiter(),
+		})
+	if r.Platform.OpenShift {
+		b = b.Owns(&routev1.Route{})
+	}
+	if r.Platform.CertManager {
+		b = b.Owns(newCertificate())
+	}
+	if r.Platform.GatewayAPI {
+		b = b.Owns(newHTTPRoute())
+	}
+	return b.Complete(r)
 }
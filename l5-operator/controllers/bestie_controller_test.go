@@ -0,0 +1,142 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestReconcileTraces records the Reconcile span and a span per component,
+// both identifying the Bestie.
+func TestReconcileTraces(t *testing.T) {
+	g := NewWithT(t)
+	// The manifests are read relative to the module root.
+	wd, err := os.Getwd()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.Chdir("..")).To(Succeed())
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(pgov1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(petsv2.AddToScheme(scheme)).To(Succeed())
+
+	bestie := &petsv2.Bestie{ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", Generation: 3}}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	r := &BestieReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(bestie).Build(),
+		Scheme: scheme,
+		Tracer: tp.Tracer(tracing.TracerName),
+	}
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "bestie", Namespace: "pets"}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	bestieAttributes := []attribute.KeyValue{
+		tracing.BestieNameKey.String("bestie"),
+		tracing.BestieNamespaceKey.String("pets"),
+		tracing.BestieGenerationKey.Int64(3),
+	}
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	g.Expect(spans).To(HaveKey("Reconcile"))
+	root := spans["Reconcile"]
+	g.Expect(root.Attributes).To(ContainElements(bestieAttributes))
+	g.Expect(spans).To(HaveKey("PostgresCluster"))
+	component := spans["PostgresCluster"]
+	g.Expect(component.Parent.SpanID()).To(Equal(root.SpanContext.SpanID()))
+	g.Expect(component.Attributes).To(ContainElements(bestieAttributes))
+}
+
+// labelScopedClient reads like the manager's cache, which only holds the
+// objects carrying the operator's managed-by label.
+type labelScopedClient struct {
+	client.Client
+}
+
+func (c labelScopedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	found := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, key, found); err != nil {
+		return err
+	}
+	if found.GetLabels()[LabelManagedBy] != ManagedByValue {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+// TestReconcileComponentAdopts adopts a component created without the
+// operator's labels, which the cache does not see.
+func TestReconcileComponentAdopts(t *testing.T) {
+	g := NewWithT(t)
+	// The manifests are read relative to the module root.
+	wd, err := os.Getwd()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.Chdir("..")).To(Succeed())
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(petsv2.AddToScheme(scheme)).To(Succeed())
+
+	bestie := &petsv2.Bestie{ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", UID: "bestie-uid"}}
+	existing := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-service", Namespace: "pets", Labels: map[string]string{"team": "pets"}},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: []corev1.ServicePort{{Port: 8000}}},
+	}
+	api := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+	r := &BestieReconciler{Client: labelScopedClient{api}, APIReader: api, Scheme: scheme}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bestie", Namespace: "pets"}}
+	ctx := context.Background()
+
+	svc := &corev1.Service{}
+	g.Expect(r.reconcileComponent(ctx, req, bestie, "Service", svc, "-service", serviceManifest, func() error {
+		r.setService(svc, bestie, false)
+		return nil
+	})).To(Succeed())
+
+	g.Expect(api.Get(ctx, client.ObjectKeyFromObject(existing), svc)).To(Succeed())
+	g.Expect(svc.Labels).To(Equal(mergeLabels(map[string]string{"team": "pets"}, labelsFor(bestie))))
+	g.Expect(metav1.IsControlledBy(svc, bestie)).To(BeTrue())
+	g.Expect(svc.Spec.ClusterIP).To(Equal("10.96.0.10"))
+	g.Expect(svc.Spec.Selector).To(Equal(map[string]string{"app": appPods}))
+
+	// From then on the cache sees it.
+	g.Expect(r.Get(ctx, client.ObjectKeyFromObject(existing), &corev1.Service{})).To(Succeed())
+}
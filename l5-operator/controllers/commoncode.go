@@ -20,9 +20,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
-	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -32,7 +37,7 @@ import (
 )
 
 // Returns whether or not the MySQL deployment is running
-func (r *BestieReconciler) isRunning(ctx context.Context, bestie *petsv1.Bestie) bool {
+func (r *BestieReconciler) isRunning(ctx context.Context, bestie *petsv2.Bestie) bool {
 	dp := &appsv1.Deployment{}
 
 	err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-app", Namespace: bestie.Namespace}, dp)
@@ -41,14 +46,34 @@ func (r *BestieReconciler) isRunning(ctx context.Context, bestie *petsv1.Bestie)
 		log.Error(err, "Deployment found")
 		return false
 	}
-	if dp.Status.ReadyReplicas == 1 {
+	if dp.Status.ReadyReplicas > 0 {
 		return true
 	}
 
 	return false
 }
 
-func (r *BestieReconciler) applyManifests(ctx context.Context, req ctrl.Request, bestie *petsv1.Bestie, obj client.Object, fileName string) error {
+func (r *BestieReconciler) applyManifests(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, obj client.Object, fileName string, mutate func() error) error {
+
+	Log := ctrllog.FromContext(ctx)
+
+	if err := r.renderManifest(ctx, bestie, obj, fileName, mutate); err != nil {
+		return err
+	}
+
+	err := r.Client.Create(ctx, obj)
+	if err != nil {
+		Log.Error(err, "Failed to create object", "object", obj.GetName())
+		return err
+	}
+
+	return nil
+}
+
+// renderManifest loads obj from the manifest in fileName and makes it an
+// object of bestie: it sets the namespace, labels and owner reference, then
+// the fields mutate manages.
+func (r *BestieReconciler) renderManifest(ctx context.Context, bestie *petsv2.Bestie, obj client.Object, fileName string, mutate func() error) error {
 
 	Log := ctrllog.FromContext(ctx)
 
@@ -65,13 +90,276 @@ func (r *BestieReconciler) applyManifests(ctx context.Context, req ctrl.Request,
 
 	obj.SetNamespace(bestie.GetNamespace())
 	//obj.SetName(bestie.GetName())
+	obj.SetLabels(mergeLabels(obj.GetLabels(), labelsFor(bestie)))
 	controllerutil.SetControllerReference(bestie, obj, r.Scheme)
 
-	err = r.Client.Create(ctx, obj)
-	if err != nil {
-		Log.Error(err, "Failed to create object", "object", obj.GetName())
-		return err
+	if mutate != nil {
+		if err = mutate(); err != nil {
+			Log.Error(err, "Failed to customize object", "object", obj.GetName())
+			return err
+		}
 	}
 
 	return nil
 }
+
+// desiredPostgresCluster returns the PostgresCluster of bestie.
+func (r *BestieReconciler) desiredPostgresCluster(bestie *petsv2.Bestie, hibernating bool) component {
+	pgo := &pgov1.PostgresCluster{}
+	return component{kind: "PostgresCluster", obj: pgo, suffix: "-pgo", manifest: postgresClusterManifest, mutate: func() error {
+		r.setPostgresCluster(pgo, bestie, hibernating)
+		return nil
+	}}
+}
+
+// desiredAppDeployment returns the app Deployment of bestie. A stopped
+// Deployment, e.g. of a hibernated Bestie waking up, is only scaled up once
+// its database is ready again.
+func (r *BestieReconciler) desiredAppDeployment(ctx context.Context, bestie *petsv2.Bestie, hibernating, databaseReady bool) component {
+	dp := &appsv1.Deployment{}
+	return component{kind: "Deployment", obj: dp, suffix: "-app", manifest: appDeploymentManifest, mutate: func() error {
+		replicas := appReplicas(bestie, hibernating)
+		if replicas > 0 && dp.Spec.Replicas != nil && *dp.Spec.Replicas == 0 && !databaseReady {
+			// Waking up: the database comes back before the app.
+			ctrllog.FromContext(ctx).Info("Waiting for the database before scaling up bestie-app")
+			replicas = 0
+		}
+		r.setAppDeployment(dp, bestie, replicas)
+		return nil
+	}}
+}
+
+// desiredMigrationJob returns the Job running the database migrations of
+// bestie.
+func (r *BestieReconciler) desiredMigrationJob(bestie *petsv2.Bestie) component {
+	job := &batchv1.Job{}
+	return component{kind: "Job", obj: job, suffix: "-job", manifest: migrationJobManifest, mutate: func() error {
+		r.setMigrationJob(job, bestie)
+		return nil
+	}}
+}
+
+// desiredService returns the bestie Service, which selects the maintenance
+// page in maintenance.
+func (r *BestieReconciler) desiredService(bestie *petsv2.Bestie, maintenance bool) component {
+	svc := &corev1.Service{}
+	return component{kind: "Service", obj: svc, suffix: "-service", manifest: serviceManifest, mutate: func() error {
+		r.setService(svc, bestie, maintenance)
+		return nil
+	}}
+}
+
+// setPostgresCluster sets the fields of the PostgresCluster the operator
+// manages.
+func (r *BestieReconciler) setPostgresCluster(pgo *pgov1.PostgresCluster, bestie *petsv2.Bestie, hibernating bool) {
+	setClusterLabels(pgo, bestie)
+	r.setDatabaseStorage(pgo, bestie)
+	setShutdown(pgo, hibernating)
+	r.setBackupSchedule(pgo, bestie, hibernating)
+	setMonitoring(pgo, bestie)
+}
+
+// setAppDeployment sets the fields of the app Deployment the operator
+// manages. While autoscaling, an existing Deployment keeps the replica count
+// the autoscaler chose.
+func (r *BestieReconciler) setAppDeployment(dp *appsv1.Deployment, bestie *petsv2.Bestie, replicas int32) {
+	if replicas > 0 && bestie.Spec.App.Autoscaling.Enabled {
+		replicas = autoscaledReplicas(dp, replicas)
+	}
+	dp.Spec.Replicas = &replicas
+	setPodLabels(&dp.Spec.Template, bestie, appPods)
+	removeLegacyDatabaseWait(&dp.Spec.Template.Spec)
+	setServingCert(&dp.Spec.Template.Spec, appPods, bestie)
+	setAppServerTLS(&dp.Spec.Template.Spec, bestie)
+	r.setAppImage(&dp.Spec.Template.Spec, bestie)
+	r.setAppResources(&dp.Spec.Template.Spec, bestie)
+	r.setSecurityContext(&dp.Spec.Template.Spec, bestie)
+	setRestartedAt(&dp.Spec.Template, bestie)
+}
+
+// setMigrationJob sets the fields of the migration Job the operator manages.
+// The pod template of an existing Job cannot change, so its pods are only
+// labelled and hardened when it is created.
+func (r *BestieReconciler) setMigrationJob(job *batchv1.Job, bestie *petsv2.Bestie) {
+	if job.ResourceVersion == "" {
+		setPodLabels(&job.Spec.Template, bestie, migrationPods)
+		r.setSecurityContext(&job.Spec.Template.Spec, bestie)
+	}
+	r.setAppImage(&job.Spec.Template.Spec, bestie)
+}
+
+// serviceAnnotationsAnnotation lists the keys of the spec.expose.service
+// annotations set on the Service, so that those dropped from the spec are
+// removed from it.
+const serviceAnnotationsAnnotation = "bestie.com/service-annotations"
+
+// setService points the bestie Service at the app, or at the maintenance
+// page during maintenance, with the type, port, annotations and source
+// ranges of spec.expose.service. Fields the API server allocates, such as
+// the cluster IP and the node ports, are kept. When TLS is reencrypted it
+// serves HTTPS, with a certificate from the service CA on OpenShift.
+func (r *BestieReconciler) setService(svc *corev1.Service, bestie *petsv2.Bestie, maintenance bool) {
+	pods := appPods
+	if maintenance {
+		pods = maintenancePods
+	}
+	svc.Spec.Selector = map[string]string{"app": pods}
+
+	spec := bestie.Spec.Expose.Service
+	svc.Spec.Type = spec.EffectiveType()
+	for i := range svc.Spec.Ports {
+		svc.Spec.Ports[i].Port = servicePort(bestie)
+		if svc.Spec.Type == corev1.ServiceTypeClusterIP {
+			svc.Spec.Ports[i].NodePort = 0
+		}
+	}
+	svc.Spec.LoadBalancerSourceRanges = nil
+	if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		svc.Spec.LoadBalancerSourceRanges = spec.LoadBalancerSourceRanges
+	}
+
+	annotations := svc.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for _, key := range strings.Split(annotations[serviceAnnotationsAnnotation], ",") {
+		if _, ok := spec.Annotations[key]; !ok {
+			delete(annotations, key)
+		}
+	}
+	keys := make([]string, 0, len(spec.Annotations))
+	for key, value := range spec.Annotations {
+		annotations[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		annotations[serviceAnnotationsAnnotation] = strings.Join(keys, ",")
+	} else {
+		delete(annotations, serviceAnnotationsAnnotation)
+	}
+	if reencrypt(bestie) && r.Platform.OpenShift {
+		annotations[openShiftServingCertAnnotation] = servingCertSecret(bestie)
+	} else {
+		delete(annotations, openShiftServingCertAnnotation)
+	}
+	svc.SetAnnotations(annotations)
+}
+
+// appImage returns the app image reference of the bestie, taking whatever
+// spec.app leaves empty from the operator defaults.
+func (r *BestieReconciler) appImage(bestie *petsv2.Bestie) string {
+	image, version := bestie.Spec.App.Image, bestie.Spec.App.Version
+	if image == "" {
+		image = r.Defaults.AppImage
+	}
+	if version == "" {
+		version = r.Defaults.AppVersion
+	}
+	if image == "" || version == "" {
+		return image
+	}
+	return image + ":" + version
+}
+
+// setAppImage points every container of the pod spec at the bestie app image.
+func (r *BestieReconciler) setAppImage(spec *corev1.PodSpec, bestie *petsv2.Bestie) {
+	image := r.appImage(bestie)
+	if image == "" {
+		return
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Image = image
+	}
+}
+
+// setAppResources sets the compute resources of the app container from
+// spec.app, or from the operator defaults when it sets none.
+func (r *BestieReconciler) setAppResources(spec *corev1.PodSpec, bestie *petsv2.Bestie) {
+	resources := bestie.Spec.App.Resources
+	if resources.Requests == nil && resources.Limits == nil {
+		resources = r.Defaults.AppResources
+	}
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == appPods {
+			resources.DeepCopyInto(&spec.Containers[i].Resources)
+		}
+	}
+}
+
+// setClusterLabels has PGO propagate the bestie labels to every object it
+// creates for the cluster, notably the user Secret the app reads.
+func setClusterLabels(pgo *pgov1.PostgresCluster, bestie *petsv2.Bestie) {
+	if pgo.Spec.Metadata == nil {
+		pgo.Spec.Metadata = &pgov1.Metadata{}
+	}
+	pgo.Spec.Metadata.Labels = mergeLabels(pgo.Spec.Metadata.Labels, labelsFor(bestie))
+}
+
+// setDatabaseStorage applies the storage class and size of spec.database to
+// the data volume of every instance set. The size falls back to the operator
+// default; volumes are only ever grown.
+func (r *BestieReconciler) setDatabaseStorage(pgo *pgov1.PostgresCluster, bestie *petsv2.Bestie) {
+	db := bestie.Spec.Database
+	storage := r.Defaults.DatabaseStorage
+	if db.Storage != nil {
+		storage = *db.Storage
+	}
+	for i := range pgo.Spec.InstanceSets {
+		claim := &pgo.Spec.InstanceSets[i].DataVolumeClaimSpec
+		if db.StorageClassName != "" {
+			claim.StorageClassName = &db.StorageClassName
+		}
+		if storage.IsZero() {
+			continue
+		}
+		if claim.Resources.Requests == nil {
+			claim.Resources.Requests = corev1.ResourceList{}
+		}
+		if current, ok := claim.Resources.Requests[corev1.ResourceStorage]; ok && storage.Cmp(current) <= 0 {
+			continue
+		}
+		claim.Resources.Requests[corev1.ResourceStorage] = storage
+	}
+}
+
+// setBackupSchedule schedules full backups on every pgBackRest repo when the
+// bestie or the operator config sets a backup schedule. Scheduled backups are
+// suspended while the Bestie is hibernating.
+func (r *BestieReconciler) setBackupSchedule(pgo *pgov1.PostgresCluster, bestie *petsv2.Bestie, hibernating bool) {
+	if hibernating {
+		for i := range pgo.Spec.Backups.PGBackRest.Repos {
+			pgo.Spec.Backups.PGBackRest.Repos[i].BackupSchedules = nil
+		}
+		return
+	}
+	schedule := bestie.Spec.Backup.Schedule
+	if schedule == "" {
+		schedule = r.Defaults.BackupSchedule
+	}
+	if schedule == "" {
+		return
+	}
+	for i := range pgo.Spec.Backups.PGBackRest.Repos {
+		full := schedule
+		pgo.Spec.Backups.PGBackRest.Repos[i].BackupSchedules = &pgov1.PGBackRestBackupSchedules{Full: &full}
+	}
+}
+
+// setMonitoring runs the PGO metrics exporter next to the database while
+// monitoring is enabled. The exporter image comes from the PGO install.
+func setMonitoring(pgo *pgov1.PostgresCluster, bestie *petsv2.Bestie) {
+	if !bestie.Spec.Monitoring.Enabled {
+		pgo.Spec.Monitoring = nil
+		return
+	}
+	if pgo.Spec.Monitoring == nil {
+		pgo.Spec.Monitoring = &pgov1.MonitoringSpec{}
+	}
+	if pgo.Spec.Monitoring.PGMonitor == nil {
+		pgo.Spec.Monitoring.PGMonitor = &pgov1.PGMonitorSpec{}
+	}
+	if pgo.Spec.Monitoring.PGMonitor.Exporter == nil {
+		pgo.Spec.Monitoring.PGMonitor.Exporter = &pgov1.ExporterSpec{}
+	}
+}
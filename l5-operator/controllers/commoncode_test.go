@@ -0,0 +1,71 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetService(t *testing.T) {
+	g := NewWithT(t)
+	r := &BestieReconciler{}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			"example.com/owner":          "ops",
+			"example.com/dropped":        "true",
+			serviceAnnotationsAnnotation: "example.com/dropped",
+		}},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeNodePort,
+			ClusterIP: "10.96.0.10",
+			Ports:     []corev1.ServicePort{{Port: 80, NodePort: 30080}},
+		},
+	}
+
+	bestie := &petsv2.Bestie{}
+	bestie.Spec.Expose.Service = petsv2.ServiceSpec{
+		Type:                     corev1.ServiceTypeLoadBalancer,
+		Port:                     8080,
+		Annotations:              map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"},
+		LoadBalancerSourceRanges: []string{"192.0.2.0/24"},
+	}
+	r.setService(svc, bestie, false)
+	g.Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeLoadBalancer))
+	g.Expect(svc.Spec.ClusterIP).To(Equal("10.96.0.10"))
+	g.Expect(svc.Spec.Ports).To(Equal([]corev1.ServicePort{{Port: 8080, NodePort: 30080}}))
+	g.Expect(svc.Spec.LoadBalancerSourceRanges).To(Equal([]string{"192.0.2.0/24"}))
+	g.Expect(svc.Spec.Selector).To(Equal(map[string]string{"app": appPods}))
+	g.Expect(svc.Annotations).To(Equal(map[string]string{
+		"example.com/owner": "ops",
+		"service.beta.kubernetes.io/aws-load-balancer-internal": "true",
+		serviceAnnotationsAnnotation:                            "service.beta.kubernetes.io/aws-load-balancer-internal",
+	}))
+
+	bestie.Spec.Expose.Service = petsv2.ServiceSpec{}
+	r.setService(svc, bestie, true)
+	g.Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+	g.Expect(svc.Spec.ClusterIP).To(Equal("10.96.0.10"))
+	g.Expect(svc.Spec.Ports).To(Equal([]corev1.ServicePort{{Port: 80}}))
+	g.Expect(svc.Spec.LoadBalancerSourceRanges).To(BeNil())
+	g.Expect(svc.Spec.Selector).To(Equal(map[string]string{"app": maintenancePods}))
+	g.Expect(svc.Annotations).To(Equal(map[string]string{"example.com/owner": "ops"}))
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// The annotations of the PostgresCluster holding the state of the
+	// credential rotation: when the last one completed, the value of the
+	// bestie.com/rotateCredentials annotation it was triggered by, and when
+	// the one waiting for PGO started.
+	credentialsRotatedAtAnnotation = "bestie.com/credentials-rotated-at"
+	credentialsTriggerAnnotation   = "bestie.com/credentials-rotation-trigger"
+	credentialsRotatingAnnotation  = "bestie.com/credentials-rotating-since"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=update;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=list;delete
+
+// credentialRotation is the outcome of a pass of the credential rotation.
+type credentialRotation struct {
+	// rotating is true while PGO has yet to write the new password, during
+	// which the pods keep the configuration they run with.
+	rotating bool
+	// requeueAfter is when to check the rotation again, 0 when not needed.
+	requeueAfter time.Duration
+}
+
+// reconcileCredentialRotation rotates the password of the database user
+// when due. The password and its verifier are removed from the user Secret,
+// which has PGO generate new ones. Once they are in, the running Jobs are
+// restarted, and so is the app, as the hash of its configuration changes.
+// Rotations only start while the database is ready.
+func (r *BestieReconciler) reconcileCredentialRotation(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, databaseReady bool, now time.Time) (credentialRotation, error) {
+	log := ctrllog.FromContext(ctx)
+
+	pgo := &pgov1.PostgresCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-pgo", Namespace: bestie.Namespace}, pgo); err != nil {
+		return credentialRotation{}, client.IgnoreNotFound(err)
+	}
+	annotations := pgo.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	pending := annotations[credentialsRotatingAnnotation] != ""
+	spec := bestie.Spec.Database.CredentialRotation
+	if spec == nil && !pending {
+		return credentialRotation{}, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: databaseUserSecret(pgo), Namespace: bestie.Namespace}, secret); err != nil {
+		return credentialRotation{}, client.IgnoreNotFound(err)
+	}
+
+	if pending {
+		if len(secret.Data["password"]) == 0 || len(secret.Data["verifier"]) == 0 {
+			log.Info("Waiting for PGO to write the new password of the database user", "secret", secret.Name)
+			return credentialRotation{rotating: true, requeueAfter: r.waitDelay(req)}, nil
+		}
+		if err := r.restartJobs(ctx, bestie); err != nil {
+			return credentialRotation{}, err
+		}
+		log.Info("Rotated the password of the database user")
+		delete(annotations, credentialsRotatingAnnotation)
+		annotations[credentialsRotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+		pgo.SetAnnotations(annotations)
+		return credentialRotation{}, r.Update(ctx, pgo)
+	}
+
+	trigger := bestie.GetAnnotations()[petsv2.RotateCredentialsAnnotation]
+	due, next, err := rotationDue(spec, pgo, trigger, now)
+	if err != nil {
+		return credentialRotation{}, err
+	}
+	if !due || !databaseReady {
+		var delay time.Duration
+		if !next.IsZero() {
+			delay = next.Sub(now)
+		}
+		return credentialRotation{requeueAfter: delay}, nil
+	}
+
+	log.Info("Rotating the password of the database user", "secret", secret.Name)
+	delete(secret.Data, "password")
+	delete(secret.Data, "verifier")
+	if err := r.Update(ctx, secret); err != nil {
+		return credentialRotation{}, err
+	}
+	annotations[credentialsRotatingAnnotation] = now.UTC().Format(time.RFC3339)
+	if trigger != "" {
+		annotations[credentialsTriggerAnnotation] = trigger
+	}
+	pgo.SetAnnotations(annotations)
+	if err := r.Update(ctx, pgo); err != nil {
+		return credentialRotation{}, err
+	}
+	return credentialRotation{rotating: true, requeueAfter: r.waitDelay(req)}, nil
+}
+
+// rotationDue returns whether the password of the database user of pgo is
+// due for rotation at now, either because the trigger annotation changed or
+// because the schedule passed since the last rotation, or since the cluster
+// was created. Otherwise it returns the next scheduled rotation, if any.
+func rotationDue(spec *petsv2.CredentialRotationSpec, pgo *pgov1.PostgresCluster, trigger string, now time.Time) (bool, time.Time, error) {
+	annotations := pgo.GetAnnotations()
+	if trigger != "" && trigger != annotations[credentialsTriggerAnnotation] {
+		return true, time.Time{}, nil
+	}
+	if spec.Schedule == "" {
+		return false, time.Time{}, nil
+	}
+	schedule, err := cron.ParseStandard(spec.Schedule)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid credential rotation schedule %q: %w", spec.Schedule, err)
+	}
+	last := pgo.CreationTimestamp.Time
+	if rotatedAt, err := time.Parse(time.RFC3339, annotations[credentialsRotatedAtAnnotation]); err == nil {
+		last = rotatedAt
+	}
+	next := schedule.Next(last)
+	if !next.After(now) {
+		return true, time.Time{}, nil
+	}
+	return false, next, nil
+}
+
+// restartJobs deletes the running migration Job of bestie, which still
+// connects with the previous password. It is created again on the next
+// pass. The Jobs PGO runs for the cluster carry the same labels and are left
+// alone.
+func (r *BestieReconciler) restartJobs(ctx context.Context, bestie *petsv2.Bestie) error {
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(bestie.Namespace), client.MatchingLabels(labelsFor(bestie))); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Name != bestie.Name+"-job" || !metav1.IsControlledBy(job, bestie) || job.Status.Active == 0 {
+			continue
+		}
+		ctrllog.FromContext(ctx).Info("Restarting the Job with the new password of the database user", "job", job.Name)
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// databaseStatus reports when the password of the database user was last
+// rotated, or nil when it never was.
+func (r *BestieReconciler) databaseStatus(ctx context.Context, bestie *petsv2.Bestie) *petsv2.DatabaseStatus {
+	pgo := &pgov1.PostgresCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-pgo", Namespace: bestie.Namespace}, pgo); err != nil {
+		return nil
+	}
+	rotatedAt, err := time.Parse(time.RFC3339, pgo.GetAnnotations()[credentialsRotatedAtAnnotation])
+	if err != nil {
+		return nil
+	}
+	return &petsv2.DatabaseStatus{CredentialsRotatedAt: &metav1.Time{Time: rotatedAt}}
+}
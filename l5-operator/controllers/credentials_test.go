@@ -0,0 +1,121 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestReconcileCredentialRotation rotates the password of the database user
+// through the annotation, then on schedule.
+func TestReconcileCredentialRotation(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(pgov1.AddToScheme(scheme)).To(Succeed())
+
+	created := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+	bestie := &petsv2.Bestie{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "bestie", Namespace: "pets", UID: "bestie-uid",
+			Annotations: map[string]string{petsv2.RotateCredentialsAnnotation: "1"},
+		},
+		Spec: petsv2.BestieSpec{Database: petsv2.DatabaseSpec{
+			CredentialRotation: &petsv2.CredentialRotationSpec{Schedule: "0 0 1 * *"},
+		}},
+	}
+	pgo := &pgov1.PostgresCluster{ObjectMeta: metav1.ObjectMeta{
+		Name: "bestie-pgo", Namespace: "pets", CreationTimestamp: metav1.NewTime(created),
+	}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo-pguser-bestie-pgo", Namespace: "pets"},
+		Data:       map[string][]byte{"host": []byte("db"), "password": []byte("first"), "verifier": []byte("SCRAM first")},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-job", Namespace: "pets", Labels: labelsFor(bestie)},
+		Status:     batchv1.JobStatus{Active: 1},
+	}
+	controller := true
+	job.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: petsv2.GroupVersion.String(), Kind: "Bestie", Name: "bestie", UID: "bestie-uid", Controller: &controller,
+	}})
+	// PGO runs its backups as Jobs carrying the labels of the PostgresCluster,
+	// which are those of bestie.
+	backup := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo-backup-abcd", Namespace: "pets", Labels: labelsFor(bestie)},
+		Status:     batchv1.JobStatus{Active: 1},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pgo, secret, job, backup).Build()
+	r := &BestieReconciler{Client: c, Scheme: scheme}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bestie", Namespace: "pets"}}
+	ctx := context.Background()
+	now := created.Add(time.Hour)
+
+	// The annotation has PGO generate a new password.
+	result, err := r.reconcileCredentialRotation(ctx, req, bestie, true, now)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.rotating).To(BeTrue())
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+	g.Expect(secret.Data).NotTo(HaveKey("password"))
+	g.Expect(secret.Data).NotTo(HaveKey("verifier"))
+
+	// Until it is in the Secret, the rotation waits.
+	result, err = r.reconcileCredentialRotation(ctx, req, bestie, true, now)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.rotating).To(BeTrue())
+	g.Expect(r.databaseStatus(ctx, bestie)).To(BeNil())
+
+	// Then the running Job is restarted and the rotation recorded.
+	secret.Data["password"] = []byte("second")
+	secret.Data["verifier"] = []byte("SCRAM second")
+	g.Expect(c.Update(ctx, secret)).To(Succeed())
+	result, err = r.reconcileCredentialRotation(ctx, req, bestie, true, now)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.rotating).To(BeFalse())
+	g.Expect(apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(job), job))).To(BeTrue())
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(backup), backup)).To(Succeed())
+	g.Expect(r.databaseStatus(ctx, bestie)).To(Equal(&petsv2.DatabaseStatus{CredentialsRotatedAt: &metav1.Time{Time: now}}))
+
+	// The same annotation does not rotate again; the schedule does, next
+	// month.
+	result, err = r.reconcileCredentialRotation(ctx, req, bestie, true, now)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.rotating).To(BeFalse())
+	g.Expect(result.requeueAfter).To(Equal(time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC).Sub(now)))
+	result, err = r.reconcileCredentialRotation(ctx, req, bestie, false, now.AddDate(0, 1, 0))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.rotating).To(BeFalse())
+	result, err = r.reconcileCredentialRotation(ctx, req, bestie, true, now.AddDate(0, 1, 0))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.rotating).To(BeTrue())
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// legacyDatabaseWaitContainer is the init container older app Deployments
+// waited for the database with. The reconciler now waits instead.
+const legacyDatabaseWaitContainer = "check-db-ready"
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// databaseReadiness returns the DatabaseReady condition of bestie. The
+// database is ready once every instance set of the PostgresCluster has a
+// ready pod and PGO has written the user Secret the app and the migration
+// Job connect with.
+func (r *BestieReconciler) databaseReadiness(ctx context.Context, bestie *petsv2.Bestie) (metav1.Condition, error) {
+	condition := metav1.Condition{
+		Type:               petsv2.ConditionDatabaseReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: bestie.Generation,
+	}
+
+	pgo := &pgov1.PostgresCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-pgo", Namespace: bestie.Namespace}, pgo); err != nil {
+		if !errors.IsNotFound(err) {
+			return condition, err
+		}
+		condition.Reason = "ClusterNotFound"
+		condition.Message = "The PostgresCluster has not been created yet"
+		return condition, nil
+	}
+	if pgo.Spec.Shutdown != nil && *pgo.Spec.Shutdown {
+		condition.Reason = "ShutDown"
+		condition.Message = "The database is shut down"
+		return condition, nil
+	}
+	if !postgresReady(pgo) {
+		var replicas, ready int32
+		for _, set := range pgo.Status.InstanceSets {
+			replicas += set.Replicas
+			ready += set.ReadyReplicas
+		}
+		condition.Reason = "InstancesNotReady"
+		condition.Message = fmt.Sprintf("%d/%d database instances are ready", ready, replicas)
+		return condition, nil
+	}
+
+	name := databaseUserSecret(pgo)
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: pgo.Namespace}, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return condition, err
+		}
+		condition.Reason = "UserSecretNotFound"
+		condition.Message = fmt.Sprintf("Waiting for PGO to create the user Secret %s", name)
+		return condition, nil
+	}
+	if len(secret.Data["host"]) == 0 {
+		condition.Reason = "UserSecretIncomplete"
+		condition.Message = fmt.Sprintf("The user Secret %s has no host yet", name)
+		return condition, nil
+	}
+
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "Ready"
+	condition.Message = "The database accepts connections"
+	return condition, nil
+}
+
+// databaseUserSecret returns the name of the Secret PGO writes the
+// connection details of the first user of pgo to. Without users, PGO
+// creates one named after the cluster.
+func databaseUserSecret(pgo *pgov1.PostgresCluster) string {
+	user := pgo.Name
+	if len(pgo.Spec.Users) > 0 {
+		user = string(pgo.Spec.Users[0].Name)
+	}
+	return pgo.Name + "-pguser-" + user
+}
+
+// removeLegacyDatabaseWait drops the init container that app Deployments
+// created by earlier versions of the operator wait for the database with.
+func removeLegacyDatabaseWait(spec *corev1.PodSpec) {
+	for i, container := range spec.InitContainers {
+		if container.Name == legacyDatabaseWaitContainer {
+			spec.InitContainers = append(spec.InitContainers[:i:i], spec.InitContainers[i+1:]...)
+			if len(spec.InitContainers) == 0 {
+				spec.InitContainers = nil
+			}
+			return
+		}
+	}
+}
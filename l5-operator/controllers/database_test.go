@@ -0,0 +1,157 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDatabaseReadiness(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(pgov1.AddToScheme(scheme)).To(Succeed())
+
+	shutdown := true
+	cluster := func(ready int32) *pgov1.PostgresCluster {
+		return &pgov1.PostgresCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo", Namespace: "pets"},
+			Status: pgov1.PostgresClusterStatus{InstanceSets: []pgov1.PostgresInstanceSetStatus{
+				{Name: "00", Replicas: 2, ReadyReplicas: ready},
+			}},
+		}
+	}
+	stopped := cluster(2)
+	stopped.Spec.Shutdown = &shutdown
+	secret := func(host string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo-pguser-bestie-pgo", Namespace: "pets"},
+			Data:       map[string][]byte{"host": []byte(host)},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		objects     []client.Object
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name:       "no cluster",
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "ClusterNotFound",
+		},
+		{
+			name:       "shut down",
+			objects:    []client.Object{stopped, secret("db")},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "ShutDown",
+		},
+		{
+			name:        "instances starting",
+			objects:     []client.Object{cluster(0)},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "InstancesNotReady",
+			wantMessage: "0/2 database instances are ready",
+		},
+		{
+			name:        "no user Secret",
+			objects:     []client.Object{cluster(1)},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "UserSecretNotFound",
+			wantMessage: "Waiting for PGO to create the user Secret bestie-pgo-pguser-bestie-pgo",
+		},
+		{
+			name:       "user Secret without host",
+			objects:    []client.Object{cluster(1), secret("")},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "UserSecretIncomplete",
+		},
+		{
+			name:       "ready",
+			objects:    []client.Object{cluster(1), secret("bestie-pgo-primary.pets.svc")},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: "Ready",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &BestieReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build(), Scheme: scheme}
+			bestie := &petsv2.Bestie{ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", Generation: 4}}
+
+			condition, err := r.databaseReadiness(context.Background(), bestie)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(condition.Type).To(Equal(petsv2.ConditionDatabaseReady))
+			g.Expect(condition.Status).To(Equal(tt.wantStatus))
+			g.Expect(condition.Reason).To(Equal(tt.wantReason))
+			g.Expect(condition.ObservedGeneration).To(Equal(int64(4)))
+			if tt.wantMessage != "" {
+				g.Expect(condition.Message).To(Equal(tt.wantMessage))
+			}
+		})
+	}
+}
+
+func TestDatabaseUserSecret(t *testing.T) {
+	g := NewWithT(t)
+	pgo := &pgov1.PostgresCluster{ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo"}}
+	g.Expect(databaseUserSecret(pgo)).To(Equal("bestie-pgo-pguser-bestie-pgo"))
+	pgo.Spec.Users = []pgov1.PostgresUserSpec{{Name: "app"}}
+	g.Expect(databaseUserSecret(pgo)).To(Equal("bestie-pgo-pguser-app"))
+}
+
+func TestRemoveLegacyDatabaseWait(t *testing.T) {
+	tests := []struct {
+		name string
+		init []corev1.Container
+		want []corev1.Container
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "only the legacy wait",
+			init: []corev1.Container{{Name: legacyDatabaseWaitContainer}},
+		},
+		{
+			name: "among others",
+			init: []corev1.Container{{Name: "setup"}, {Name: legacyDatabaseWaitContainer}, {Name: "warmup"}},
+			want: []corev1.Container{{Name: "setup"}, {Name: "warmup"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &corev1.PodSpec{InitContainers: tt.init}
+			removeLegacyDatabaseWait(spec)
+			NewWithT(t).Expect(spec.InitContainers).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// exposeType returns how the app of the bestie is exposed. Without an
+// explicit type it is a Route on OpenShift and an Ingress elsewhere.
+func (r *BestieReconciler) exposeType(bestie *petsv2.Bestie) petsv2.ExposeType {
+	if t := bestie.Spec.Expose.Type; t != "" {
+		return t
+	}
+	return DefaultExposeType(r.Platform.OpenShift)
+}
+
+// DefaultExposeType returns the expose type of a Bestie that does not set one.
+func DefaultExposeType(openShift bool) petsv2.ExposeType {
+	if openShift {
+		return petsv2.ExposeRoute
+	}
+	return petsv2.ExposeIngress
+}
+
+// reconcileExposure exposes the bestie Service through a Route, an Ingress
+// or an HTTPRoute and removes the others, e.g. after the expose type was
+// changed. The Route and HTTPRoute send canaryWeight percent of the traffic
+// to the canary Service during a rollout.
+func (r *BestieReconciler) reconcileExposure(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, canaryWeight int32) error {
+	var cert *corev1.Secret
+	switch t := r.exposeType(bestie); t {
+	case petsv2.ExposeRoute:
+		var err error
+		if cert, err = r.routeCertificate(ctx, bestie); err != nil {
+			return err
+		}
+	case petsv2.ExposeGateway:
+		if !r.Platform.GatewayAPI {
+			return fmt.Errorf("expose type %s requires the Gateway API", t)
+		}
+	}
+	c, err := r.desiredExposure(bestie, cert, canaryWeight)
+	if err != nil {
+		return err
+	}
+	if err := r.reconcileDesired(ctx, req, bestie, c); err != nil {
+		return err
+	}
+	return r.removeExposures(ctx, bestie)
+}
+
+// desiredExposure returns the Route, Ingress or HTTPRoute exposing the
+// bestie Service. A Route embeds cert, unless it is nil.
+func (r *BestieReconciler) desiredExposure(bestie *petsv2.Bestie, cert *corev1.Secret, canaryWeight int32) (component, error) {
+	switch t := r.exposeType(bestie); t {
+	case petsv2.ExposeRoute:
+		if !r.Platform.OpenShift {
+			return component{}, fmt.Errorf("expose type %s requires OpenShift", t)
+		}
+		route := &routev1.Route{}
+		return component{kind: "Route", obj: route, suffix: "-route", manifest: routeManifest, mutate: func() error {
+			setRoute(route, bestie, cert)
+			setRouteBackends(route, bestie, canaryWeight)
+			return nil
+		}}, nil
+	case petsv2.ExposeIngress:
+		ingress := &networkingv1.Ingress{}
+		return component{kind: "Ingress", obj: ingress, suffix: "-ingress", manifest: ingressManifest, mutate: func() error {
+			setIngress(ingress, bestie)
+			return nil
+		}}, nil
+	case petsv2.ExposeGateway:
+		route := newHTTPRoute()
+		return component{kind: "HTTPRoute", obj: route, suffix: "-httproute", manifest: httpRouteManifest, mutate: func() error {
+			return setHTTPRoute(route, bestie, canaryWeight)
+		}}, nil
+	default:
+		return component{}, fmt.Errorf("unknown expose type %q", t)
+	}
+}
+
+// removeExposures removes the objects of every expose type but the one of
+// bestie, among those the cluster serves.
+func (r *BestieReconciler) removeExposures(ctx context.Context, bestie *petsv2.Bestie) error {
+	t := r.exposeType(bestie)
+	if t != petsv2.ExposeRoute && r.Platform.OpenShift {
+		if err := r.removeComponent(ctx, bestie, "Route", &routev1.Route{}, "-route"); err != nil {
+			return err
+		}
+	}
+	if t != petsv2.ExposeIngress {
+		if err := r.removeComponent(ctx, bestie, "Ingress", &networkingv1.Ingress{}, "-ingress"); err != nil {
+			return err
+		}
+	}
+	if t != petsv2.ExposeGateway && r.Platform.GatewayAPI {
+		return r.removeComponent(ctx, bestie, "HTTPRoute", newHTTPRoute(), "-httproute")
+	}
+	return nil
+}
+
+// exposedURL returns the URL the app is reachable at from outside the
+// cluster and what it was taken from. While the Route, Ingress or HTTPRoute
+// has no host yet, it falls back to the external address of the bestie
+// Service, and returns "" when there is none either.
+func (r *BestieReconciler) exposedURL(ctx context.Context, bestie *petsv2.Bestie) (string, string) {
+	var host string
+	var tls bool
+	t := r.exposeType(bestie)
+	switch t {
+	case petsv2.ExposeRoute:
+		route := &routev1.Route{}
+		if r.Platform.OpenShift && r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-route", Namespace: bestie.Namespace}, route) == nil {
+			host = admittedHost(route)
+			tls = route.Spec.TLS != nil
+		}
+	case petsv2.ExposeIngress:
+		ingress := &networkingv1.Ingress{}
+		if r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-ingress", Namespace: bestie.Namespace}, ingress) == nil {
+			if len(ingress.Spec.Rules) > 0 {
+				host = ingress.Spec.Rules[0].Host
+			}
+			if lb := ingress.Status.LoadBalancer.Ingress; host == "" && len(lb) > 0 {
+				host = lb[0].Hostname
+				if host == "" {
+					host = lb[0].IP
+				}
+			}
+			tls = len(ingress.Spec.TLS) > 0
+		}
+	case petsv2.ExposeGateway:
+		host, tls = r.gatewayEndpoint(ctx, bestie)
+	}
+	if host != "" {
+		return endpointURL(tls, host, 0), string(t)
+	}
+
+	svc := &corev1.Service{}
+	if r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-service", Namespace: bestie.Namespace}, svc) != nil || len(svc.Spec.Ports) == 0 {
+		return "", ""
+	}
+	if lb := svc.Status.LoadBalancer.Ingress; len(lb) > 0 {
+		host = lb[0].Hostname
+		if host == "" {
+			host = lb[0].IP
+		}
+	} else if len(svc.Spec.ExternalIPs) > 0 {
+		host = svc.Spec.ExternalIPs[0]
+	}
+	if host == "" {
+		return "", ""
+	}
+	return endpointURL(reencrypt(bestie), host, svc.Spec.Ports[0].Port), petsv2.ExposureLoadBalancer
+}
+
+// internalServiceURL returns the URL the app is reachable at from inside the
+// cluster, or "" while the bestie Service does not exist.
+func (r *BestieReconciler) internalServiceURL(ctx context.Context, bestie *petsv2.Bestie) string {
+	svc := &corev1.Service{}
+	if r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-service", Namespace: bestie.Namespace}, svc) != nil || len(svc.Spec.Ports) == 0 {
+		return ""
+	}
+	return endpointURL(reencrypt(bestie), svc.Name+"."+svc.Namespace+".svc", svc.Spec.Ports[0].Port)
+}
+
+// admittedHost returns the host a router admitted route under, or "" while
+// none did.
+func admittedHost(route *routev1.Route) string {
+	for _, ingress := range route.Status.Ingress {
+		for _, cond := range ingress.Conditions {
+			if cond.Type == routev1.RouteAdmitted && cond.Status == corev1.ConditionTrue {
+				return ingress.Host
+			}
+		}
+	}
+	return ""
+}
+
+// endpointURL returns the http or https URL of host, with port unless it is
+// the default one of the scheme or 0.
+func endpointURL(tls bool, host string, port int32) string {
+	scheme, defaultPort := "http", int32(80)
+	if tls {
+		scheme, defaultPort = "https", 443
+	}
+	if port != 0 && port != defaultPort {
+		host = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/platform"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExposedURL(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(routev1.AddToScheme(scheme)).To(Succeed())
+
+	meta := func(suffix string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: "bestie" + suffix, Namespace: "pets"}
+	}
+	svc := func(port int32, lb ...corev1.LoadBalancerIngress) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: meta("-service"),
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: port}}},
+			Status:     corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: lb}},
+		}
+	}
+
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"listeners": []interface{}{
+			map[string]interface{}{"name": "http", "protocol": "HTTP"},
+			map[string]interface{}{"name": "https", "protocol": "HTTPS"},
+		}},
+		"status": map[string]interface{}{"addresses": []interface{}{map[string]interface{}{"value": "192.0.2.30"}}},
+	}}
+	gateway.SetGroupVersionKind(gatewayGVK)
+	gateway.SetName("public")
+	gateway.SetNamespace("gateways")
+	httpRoute := newHTTPRoute()
+	httpRoute.SetName("bestie-httproute")
+	httpRoute.SetNamespace("pets")
+
+	tests := []struct {
+		name         string
+		openShift    bool
+		gatewayAPI   bool
+		expose       petsv2.ExposeSpec
+		objects      []client.Object
+		apiObjects   []client.Object
+		wantURL      string
+		wantType     string
+		wantInternal string
+	}{
+		{
+			name:      "admitted route",
+			openShift: true,
+			objects: []client.Object{svc(80), &routev1.Route{
+				ObjectMeta: meta("-route"),
+				Spec:       routev1.RouteSpec{TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge}},
+				Status: routev1.RouteStatus{Ingress: []routev1.RouteIngress{
+					{Host: "rejected.example.com", Conditions: []routev1.RouteIngressCondition{{Type: routev1.RouteAdmitted, Status: corev1.ConditionFalse}}},
+					{Host: "bestie.apps.example.com", Conditions: []routev1.RouteIngressCondition{{Type: routev1.RouteAdmitted, Status: corev1.ConditionTrue}}},
+				}},
+			}},
+			wantURL:      "https://bestie.apps.example.com",
+			wantType:     "Route",
+			wantInternal: "http://bestie-service.pets.svc",
+		},
+		{
+			name: "ingress load balancer",
+			objects: []client.Object{svc(80), &networkingv1.Ingress{
+				ObjectMeta: meta("-ingress"),
+				Status: networkingv1.IngressStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}},
+				}},
+			}},
+			wantURL:      "http://192.0.2.10",
+			wantType:     "Ingress",
+			wantInternal: "http://bestie-service.pets.svc",
+		},
+		{
+			name:       "https gateway listener",
+			gatewayAPI: true,
+			expose: petsv2.ExposeSpec{
+				Type:      petsv2.ExposeGateway,
+				ParentRef: &petsv2.GatewayParentReference{Name: "public", Namespace: "gateways", SectionName: "https"},
+			},
+			objects:      []client.Object{svc(80), gateway, httpRoute},
+			wantURL:      "https://192.0.2.30",
+			wantType:     "Gateway",
+			wantInternal: "http://bestie-service.pets.svc",
+		},
+		{
+			name:       "gateway outside the cache",
+			gatewayAPI: true,
+			expose: petsv2.ExposeSpec{
+				Type:      petsv2.ExposeGateway,
+				ParentRef: &petsv2.GatewayParentReference{Name: "public", Namespace: "gateways", SectionName: "https"},
+			},
+			objects:      []client.Object{svc(80), httpRoute},
+			apiObjects:   []client.Object{gateway},
+			wantURL:      "https://192.0.2.30",
+			wantType:     "Gateway",
+			wantInternal: "http://bestie-service.pets.svc",
+		},
+		{
+			name:         "service external ip",
+			objects:      []client.Object{svc(8080, corev1.LoadBalancerIngress{IP: "192.0.2.20"})},
+			wantURL:      "http://192.0.2.20:8080",
+			wantType:     petsv2.ExposureLoadBalancer,
+			wantInternal: "http://bestie-service.pets.svc:8080",
+		},
+		{
+			name:         "reencrypting service",
+			expose:       petsv2.ExposeSpec{TLS: &petsv2.TLSSpec{Termination: petsv2.TLSTerminationReencrypt}},
+			objects:      []client.Object{svc(443)},
+			wantInternal: "https://bestie-service.pets.svc",
+		},
+		{
+			name: "nothing yet",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			bestie := &petsv2.Bestie{ObjectMeta: meta(""), Spec: petsv2.BestieSpec{Expose: tt.expose}}
+			r := &BestieReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build(),
+				Platform: platform.Platform{OpenShift: tt.openShift, GatewayAPI: tt.gatewayAPI},
+			}
+			if tt.apiObjects != nil {
+				r.APIReader = fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.apiObjects...).Build()
+			}
+
+			url, exposure := r.exposedURL(context.Background(), bestie)
+			g.Expect(url).To(Equal(tt.wantURL))
+			g.Expect(exposure).To(Equal(tt.wantType))
+			g.Expect(r.internalServiceURL(context.Background(), bestie)).To(Equal(tt.wantInternal))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The kinds of the Gateway API. They are handled as unstructured objects,
+// as the Gateway API may not be installed.
+var (
+	httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}
+	gatewayGVK   = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "Gateway"}
+)
+
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+
+// newHTTPRoute returns an empty HTTPRoute.
+func newHTTPRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	return route
+}
+
+// setHTTPRoute attaches the HTTPRoute to the Gateway of spec.expose.parentRef
+// for the host of spec.expose, and points it at the port of the bestie
+// Service. During a rollout, canaryWeight percent of the traffic goes to the
+// canary Service.
+func setHTTPRoute(route *unstructured.Unstructured, bestie *petsv2.Bestie, canaryWeight int32) error {
+	ref := bestie.Spec.Expose.ParentRef
+	if ref == nil {
+		return errors.New("spec.expose.parentRef is required for the Gateway expose type")
+	}
+	parent := map[string]interface{}{"name": ref.Name}
+	if ref.Namespace != "" {
+		parent["namespace"] = ref.Namespace
+	}
+	if ref.SectionName != "" {
+		parent["sectionName"] = ref.SectionName
+	}
+	if err := unstructured.SetNestedSlice(route.Object, []interface{}{parent}, "spec", "parentRefs"); err != nil {
+		return err
+	}
+
+	if host := bestie.Spec.Expose.Host; host != "" {
+		if err := unstructured.SetNestedStringSlice(route.Object, []string{host}, "spec", "hostnames"); err != nil {
+			return err
+		}
+	} else {
+		unstructured.RemoveNestedField(route.Object, "spec", "hostnames")
+	}
+
+	rules, _, err := unstructured.NestedSlice(route.Object, "spec", "rules")
+	if err != nil {
+		return err
+	}
+	port := int64(servicePort(bestie))
+	for _, rule := range rules {
+		backends, _ := rule.(map[string]interface{})["backendRefs"].([]interface{})
+		if len(backends) == 0 {
+			continue
+		}
+		// The first backend is the bestie Service.
+		stable := backends[0].(map[string]interface{})
+		stable["port"] = port
+		backends = backends[:1]
+		delete(stable, "weight")
+		if canaryWeight > 0 {
+			stable["weight"] = int64(100 - canaryWeight)
+			backends = append(backends, map[string]interface{}{
+				"name":   bestie.Name + "-service-canary",
+				"port":   port,
+				"weight": int64(canaryWeight),
+			})
+		}
+		rule.(map[string]interface{})["backendRefs"] = backends
+	}
+	return unstructured.SetNestedSlice(route.Object, rules, "spec", "rules")
+}
+
+// gatewayEndpoint returns the host the HTTPRoute of bestie is reachable at,
+// its first hostname or else the first address of its Gateway, and whether
+// the Gateway listener it attaches to serves HTTPS. TLS is configured on the
+// listener, which the operator does not manage.
+func (r *BestieReconciler) gatewayEndpoint(ctx context.Context, bestie *petsv2.Bestie) (host string, tls bool) {
+	route := newHTTPRoute()
+	if !r.Platform.GatewayAPI || r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-httproute", Namespace: bestie.Namespace}, route) != nil {
+		return "", false
+	}
+	if hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames"); len(hostnames) > 0 {
+		host = hostnames[0]
+	}
+
+	ref := bestie.Spec.Expose.ParentRef
+	if ref == nil {
+		return host, false
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = bestie.Namespace
+	}
+	// The Gateway usually lives in a shared namespace the cache may not
+	// cover, and is not worth an informer of its own.
+	gateway := &unstructured.Unstructured{}
+	gateway.SetGroupVersionKind(gatewayGVK)
+	if r.reader().Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, gateway) != nil {
+		return host, false
+	}
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	for _, l := range listeners {
+		listener, _ := l.(map[string]interface{})
+		name, _, _ := unstructured.NestedString(listener, "name")
+		protocol, _, _ := unstructured.NestedString(listener, "protocol")
+		if (ref.SectionName == "" || name == ref.SectionName) && protocol == "HTTPS" {
+			tls = true
+		}
+	}
+	if host != "" {
+		return host, tls
+	}
+	addresses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+	if len(addresses) == 0 {
+		return "", false
+	}
+	value, _, _ := unstructured.NestedString(addresses[0].(map[string]interface{}), "value")
+	return value, tls
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/robfig/cron/v3"
+)
+
+// hibernationState returns whether bestie should be hibernated at now and,
+// for scheduled hibernation, when that changes next. The zero time is
+// returned when there is no upcoming transition.
+func hibernationState(bestie *petsv2.Bestie, now time.Time) (bool, time.Time, error) {
+	hibernate := bestie.Spec.Hibernate
+	if hibernate.Enabled {
+		return true, time.Time{}, nil
+	}
+	if hibernate.Schedule == nil {
+		return false, time.Time{}, nil
+	}
+
+	sleep, err := cron.ParseStandard(hibernate.Schedule.Sleep)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid hibernate sleep schedule %q: %w", hibernate.Schedule.Sleep, err)
+	}
+	wake, err := cron.ParseStandard(hibernate.Schedule.Wake)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid hibernate wake schedule %q: %w", hibernate.Schedule.Wake, err)
+	}
+
+	// Inside the window the next wake-up comes before the next sleep.
+	nextSleep, nextWake := sleep.Next(now), wake.Next(now)
+	if nextWake.Before(nextSleep) {
+		return true, nextWake, nil
+	}
+	return false, nextSleep, nil
+}
+
+// setShutdown shuts the database down while hibernating and starts it again afterwards.
+func setShutdown(pgo *pgov1.PostgresCluster, hibernating bool) {
+	if hibernating {
+		shutdown := true
+		pgo.Spec.Shutdown = &shutdown
+		return
+	}
+	if pgo.Spec.Shutdown != nil {
+		shutdown := false
+		pgo.Spec.Shutdown = &shutdown
+	}
+}
+
+// postgresReady returns whether every instance set of the cluster has a ready pod.
+func postgresReady(pgo *pgov1.PostgresCluster) bool {
+	if pgo.Spec.Shutdown != nil && *pgo.Spec.Shutdown {
+		return false
+	}
+	if len(pgo.Status.InstanceSets) == 0 {
+		return false
+	}
+	for _, set := range pgo.Status.InstanceSets {
+		if set.ReadyReplicas == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// requeueAfter returns the shortest non-zero delay, or zero when there is none.
+func requeueAfter(delays ...time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, d := range delays {
+		if d > 0 && (shortest == 0 || d < shortest) {
+			shortest = d
+		}
+	}
+	return shortest
+}
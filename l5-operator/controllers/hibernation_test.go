@@ -0,0 +1,163 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	pgov1 "github.com/crunchydata/postgres-operator/pkg/apis/postgres-operator.crunchydata.com/v1beta1"
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+)
+
+func TestHibernationState(t *testing.T) {
+	// Hibernated on weekday evenings and over the weekend.
+	weekdays := &petsv2.HibernateSchedule{Sleep: "0 20 * * 1-5", Wake: "0 8 * * 1-5"}
+	// 2022-03-01 is a Tuesday.
+	at := func(day, hour int) time.Time {
+		return time.Date(2022, time.March, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		hibernate petsv2.HibernateSpec
+		now       time.Time
+		want      bool
+		wantNext  time.Time
+		wantErr   string
+	}{
+		{
+			name: "awake",
+			now:  at(1, 12),
+		},
+		{
+			name:      "on demand",
+			hibernate: petsv2.HibernateSpec{Enabled: true, Schedule: weekdays},
+			now:       at(1, 12),
+			want:      true,
+		},
+		{
+			name:      "before the window",
+			hibernate: petsv2.HibernateSpec{Schedule: weekdays},
+			now:       at(1, 12),
+			wantNext:  at(1, 20),
+		},
+		{
+			name:      "inside the window",
+			hibernate: petsv2.HibernateSpec{Schedule: weekdays},
+			now:       at(1, 22),
+			want:      true,
+			wantNext:  at(2, 8),
+		},
+		{
+			name:      "over the weekend",
+			hibernate: petsv2.HibernateSpec{Schedule: weekdays},
+			now:       at(5, 12),
+			want:      true,
+			wantNext:  at(7, 8),
+		},
+		{
+			name:      "invalid sleep schedule",
+			hibernate: petsv2.HibernateSpec{Schedule: &petsv2.HibernateSchedule{Sleep: "at night", Wake: "0 8 * * *"}},
+			now:       at(1, 12),
+			wantErr:   "invalid hibernate sleep schedule",
+		},
+		{
+			name:      "invalid wake schedule",
+			hibernate: petsv2.HibernateSpec{Schedule: &petsv2.HibernateSchedule{Sleep: "0 20 * * *", Wake: "0 25 * * *"}},
+			now:       at(1, 12),
+			wantErr:   "invalid hibernate wake schedule",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			bestie := &petsv2.Bestie{Spec: petsv2.BestieSpec{Hibernate: tt.hibernate}}
+			hibernating, next, err := hibernationState(bestie, tt.now)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(hibernating).To(Equal(tt.want))
+			g.Expect(next).To(Equal(tt.wantNext))
+		})
+	}
+}
+
+func TestPostgresReady(t *testing.T) {
+	shutdown := true
+	tests := []struct {
+		name string
+		pgo  pgov1.PostgresCluster
+		want bool
+	}{
+		{
+			name: "no instances yet",
+		},
+		{
+			name: "every instance set ready",
+			pgo: pgov1.PostgresCluster{Status: pgov1.PostgresClusterStatus{InstanceSets: []pgov1.PostgresInstanceSetStatus{
+				{Name: "00", Replicas: 2, ReadyReplicas: 1},
+				{Name: "01", Replicas: 1, ReadyReplicas: 1},
+			}}},
+			want: true,
+		},
+		{
+			name: "an instance set without ready pods",
+			pgo: pgov1.PostgresCluster{Status: pgov1.PostgresClusterStatus{InstanceSets: []pgov1.PostgresInstanceSetStatus{
+				{Name: "00", Replicas: 1, ReadyReplicas: 1},
+				{Name: "01", Replicas: 1},
+			}}},
+		},
+		{
+			name: "shut down",
+			pgo: pgov1.PostgresCluster{
+				Spec: pgov1.PostgresClusterSpec{Shutdown: &shutdown},
+				Status: pgov1.PostgresClusterStatus{InstanceSets: []pgov1.PostgresInstanceSetStatus{
+					{Name: "00", Replicas: 1, ReadyReplicas: 1},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			NewWithT(t).Expect(postgresReady(&tt.pgo)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestRequeueAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		delays []time.Duration
+		want   time.Duration
+	}{
+		{name: "none"},
+		{name: "only zero", delays: []time.Duration{0, 0}},
+		{name: "shortest", delays: []time.Duration{time.Hour, 0, time.Minute, 5 * time.Minute}, want: time.Minute},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			NewWithT(t).Expect(requeueAfter(tt.delays...)).To(Equal(tt.want))
+		})
+	}
+}
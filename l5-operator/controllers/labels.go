@@ -0,0 +1,103 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// LabelManagedBy marks every object created for a Bestie.
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// LabelInstance holds the name of the Bestie an object belongs to.
+	LabelInstance = "app.kubernetes.io/instance"
+	// ManagedByValue is the value of LabelManagedBy on objects created by this operator.
+	ManagedByValue = "l5-operator"
+)
+
+// labelsFor returns the labels set on every object created for bestie.
+func labelsFor(bestie *petsv2.Bestie) map[string]string {
+	return map[string]string{
+		LabelManagedBy: ManagedByValue,
+		LabelInstance:  bestie.Name,
+	}
+}
+
+// instanceOf maps an object created for a Bestie, by the operator or by PGO
+// on its behalf, to a reconcile request for that Bestie.
+func instanceOf(obj client.Object) []reconcile.Request {
+	l := obj.GetLabels()
+	if l[LabelManagedBy] != ManagedByValue || l[LabelInstance] == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: l[LabelInstance], Namespace: obj.GetNamespace()}}}
+}
+
+// mergeLabels returns the union of the given label sets, later sets winning.
+func mergeLabels(sets ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, set := range sets {
+		for k, v := range set {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// NewCache returns a cache restricted to the given namespaces, or to every
+// namespace when none are given. Deployments, Services, Jobs, ConfigMaps,
+// Secrets, autoscalers, Ingresses and NetworkPolicies are only cached when
+// they carry the operator's managed-by label, which keeps memory flat on
+// large clusters. Unlabelled objects of a Bestie are adopted by
+// reconcileComponent.
+func NewCache(namespaces []string) cache.NewCacheFunc {
+	managed := cache.ObjectSelector{
+		Label: labels.SelectorFromSet(labels.Set{LabelManagedBy: ManagedByValue}),
+	}
+
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		opts.SelectorsByObject = cache.SelectorsByObject{
+			&appsv1.Deployment{}:                     managed,
+			&corev1.Service{}:                        managed,
+			&batchv1.Job{}:                           managed,
+			&corev1.ConfigMap{}:                      managed,
+			&corev1.Secret{}:                         managed,
+			&autoscalingv2.HorizontalPodAutoscaler{}: managed,
+			&networkingv1.Ingress{}:                  managed,
+			&networkingv1.NetworkPolicy{}:            managed,
+		}
+
+		if len(namespaces) > 1 {
+			return cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		}
+		if len(namespaces) == 1 {
+			opts.Namespace = namespaces[0]
+		}
+		return cache.New(config, opts)
+	}
+}
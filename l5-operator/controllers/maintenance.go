@@ -0,0 +1,174 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// appPods and maintenancePods are the values of the "app" label the
+	// bestie Service selects to send traffic to the app or the maintenance page.
+	appPods         = "bestie"
+	maintenancePods = "bestie-maintenance"
+
+	// maintenanceContainer is the container serving the maintenance page.
+	maintenanceContainer = "maintenance"
+
+	defaultMaintenanceMessage = "We are down for planned maintenance and will be back shortly."
+)
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+
+var maintenancePage = template.Must(template.New("index.html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>{{ .AgencyName }} - Maintenance</title>
+</head>
+<body>
+  <h1>{{ .AgencyName }}</h1>
+  <p>{{ .Message }}</p>
+</body>
+</html>
+`))
+
+// maintenanceServer is the nginx configuration of the maintenance page,
+// which is served over HTTPS like the app when TLS is reencrypted.
+var maintenanceServer = template.Must(template.New("default.conf").Parse(`server {
+  listen 8000{{ if .TLS }} ssl{{ end }};
+{{- if .TLS }}
+  ssl_certificate {{ .CertPath }}/tls.crt;
+  ssl_certificate_key {{ .CertPath }}/tls.key;
+{{- end }}
+  root /usr/share/nginx/html;
+  location / {
+    try_files $uri /index.html;
+  }
+}
+`))
+
+// renderMaintenancePage renders the static page served while bestie is in maintenance.
+func renderMaintenancePage(bestie *petsv2.Bestie) (string, error) {
+	message := bestie.Spec.Maintenance.Message
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	var buf bytes.Buffer
+	err := maintenancePage.Execute(&buf, struct{ AgencyName, Message string }{bestie.Spec.AgencyName, message})
+	return buf.String(), err
+}
+
+// appReplicas returns the number of replicas the app Deployment should run.
+func appReplicas(bestie *petsv2.Bestie, hibernating bool) int32 {
+	if bestie.Spec.Maintenance.Enabled || hibernating {
+		return 0
+	}
+	return bestie.Spec.App.Replicas
+}
+
+// reconcileMaintenancePage creates the ConfigMap and Deployment serving the maintenance page.
+func (r *BestieReconciler) reconcileMaintenancePage(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie) error {
+	for _, c := range r.desiredMaintenancePage(bestie) {
+		if err := r.reconcileDesired(ctx, req, bestie, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desiredMaintenancePage returns the ConfigMap and Deployment serving the
+// maintenance page, in the order they are created.
+func (r *BestieReconciler) desiredMaintenancePage(bestie *petsv2.Bestie) []component {
+	cm := &corev1.ConfigMap{}
+	dp := &appsv1.Deployment{}
+	return []component{
+		{kind: "MaintenanceConfigMap", obj: cm, suffix: "-maintenance", manifest: maintenanceConfigMapManifest, mutate: func() error {
+			return setMaintenancePage(cm, bestie)
+		}},
+		{kind: "MaintenanceDeployment", obj: dp, suffix: "-maintenance", manifest: maintenanceDeploymentManifest, mutate: func() error {
+			setPodLabels(&dp.Spec.Template, bestie, maintenancePods)
+			setServingCert(&dp.Spec.Template.Spec, maintenanceContainer, bestie)
+			r.setSecurityContext(&dp.Spec.Template.Spec, bestie)
+			return nil
+		}},
+	}
+}
+
+// setMaintenancePage puts the rendered maintenance page into the ConfigMap
+// the maintenance Deployment serves.
+func setMaintenancePage(cm *corev1.ConfigMap, bestie *petsv2.Bestie) error {
+	page, err := renderMaintenancePage(bestie)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data["index.html"] = page
+
+	var conf bytes.Buffer
+	if err := maintenanceServer.Execute(&conf, struct {
+		TLS      bool
+		CertPath string
+	}{reencrypt(bestie), servingCertPath}); err != nil {
+		return err
+	}
+	cm.Data["default.conf"] = conf.String()
+	return nil
+}
+
+// removeMaintenancePage deletes the maintenance page once traffic is back on the app.
+func (r *BestieReconciler) removeMaintenancePage(ctx context.Context, bestie *petsv2.Bestie) error {
+	log := ctrllog.FromContext(ctx)
+	key := types.NamespacedName{Name: bestie.Name + "-maintenance", Namespace: bestie.Namespace}
+
+	for _, obj := range []client.Object{&appsv1.Deployment{}, &corev1.ConfigMap{}} {
+		if err := r.Get(ctx, key, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("Removing the maintenance page", "object", obj.GetName())
+		if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servesMaintenancePage returns whether the bestie Service currently routes
+// traffic to the maintenance page.
+func (r *BestieReconciler) servesMaintenancePage(ctx context.Context, bestie *petsv2.Bestie) bool {
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-service", Namespace: bestie.Namespace}, svc); err != nil {
+		return false
+	}
+	return svc.Spec.Selector["app"] == maintenancePods
+}
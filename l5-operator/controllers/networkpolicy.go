@@ -0,0 +1,221 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// migrationPods is the value of the "app" label of the migration Job
+	// pods.
+	migrationPods = "bestie-migration"
+
+	// pgoClusterLabel is the label PGO sets on every pod of a cluster.
+	pgoClusterLabel = "postgres-operator.crunchydata.com/cluster"
+
+	// postgresPort and exporterPort are where Postgres and its metrics
+	// exporter listen.
+	postgresPort = 5432
+	exporterPort = 9187
+
+	// openShiftPolicyGroupLabel is the label OpenShift sets on the namespaces
+	// of the router and of the cluster monitoring.
+	openShiftPolicyGroupLabel = "network.openshift.io/policy-group"
+)
+
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// The suffixes of the NetworkPolicies of a Bestie.
+var networkPolicySuffixes = []string{"-database-policy", "-app-policy", "-egress-policy"}
+
+// reconcileNetworkPolicies creates the NetworkPolicies of bestie when
+// spec.networkPolicy is enabled, and removes them otherwise.
+func (r *BestieReconciler) reconcileNetworkPolicies(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie) error {
+	policies := r.desiredNetworkPolicies(bestie)
+	for _, suffix := range networkPolicySuffixes {
+		c, ok := policies[suffix]
+		if !ok {
+			if err := r.removeComponent(ctx, bestie, "NetworkPolicy"+suffix, &networkingv1.NetworkPolicy{}, suffix); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.reconcileDesired(ctx, req, bestie, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desiredNetworkPolicies returns the NetworkPolicies bestie wants, by name
+// suffix.
+func (r *BestieReconciler) desiredNetworkPolicies(bestie *petsv2.Bestie) map[string]component {
+	spec := bestie.Spec.NetworkPolicy
+	if !spec.Enabled {
+		return nil
+	}
+	setters := map[string]func(*networkingv1.NetworkPolicy){
+		"-database-policy": func(np *networkingv1.NetworkPolicy) { r.setDatabasePolicy(np, bestie) },
+		"-app-policy":      func(np *networkingv1.NetworkPolicy) { r.setAppPolicy(np, bestie) },
+	}
+	if spec.Egress != nil && spec.Egress.Enabled {
+		setters["-egress-policy"] = func(np *networkingv1.NetworkPolicy) { setEgressPolicy(np, bestie) }
+	}
+	policies := make(map[string]component, len(setters))
+	for suffix, set := range setters {
+		suffix, set := suffix, set
+		np := &networkingv1.NetworkPolicy{}
+		policies[suffix] = component{kind: "NetworkPolicy" + suffix, obj: np, suffix: suffix, manifest: networkPolicyManifest, mutate: func() error {
+			np.SetName(bestie.Name + suffix)
+			set(np)
+			return nil
+		}}
+	}
+	return policies
+}
+
+// setDatabasePolicy lets the database pods only accept connections from
+// each other, for replication and backups, from the app and the migration
+// Job, and, with monitoring enabled, scrapes of the exporter.
+func (r *BestieReconciler) setDatabasePolicy(np *networkingv1.NetworkPolicy, bestie *petsv2.Bestie) {
+	cluster := databasePods(bestie)
+	ingress := []networkingv1.NetworkPolicyIngressRule{
+		{From: []networkingv1.NetworkPolicyPeer{{PodSelector: cluster}}},
+		{
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: podsOf(bestie, appPods, canaryPods, migrationPods)}},
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(postgresPort))},
+		},
+	}
+	if bestie.Spec.Monitoring.Enabled {
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  []networkingv1.NetworkPolicyPeer{{NamespaceSelector: r.monitoringNamespaces(bestie)}},
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(exporterPort))},
+		})
+	}
+	np.Spec = networkingv1.NetworkPolicySpec{
+		PodSelector: *cluster,
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress:     ingress,
+	}
+}
+
+// setAppPolicy lets the pods serving traffic only accept connections from
+// the router, ingress controller or Gateway, and from monitoring. A NodePort
+// or LoadBalancer Service reaches them from outside the cluster, so their
+// http port is then open to any source.
+func (r *BestieReconciler) setAppPolicy(np *networkingv1.NetworkPolicy, bestie *petsv2.Bestie) {
+	ingress := []networkingv1.NetworkPolicyIngressRule{
+		{From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: r.ingressNamespaces(bestie)}}},
+		{From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: r.monitoringNamespaces(bestie)}}},
+	}
+	if bestie.Spec.Expose.Service.EffectiveType() != corev1.ServiceTypeClusterIP {
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromString("http"))},
+		})
+	}
+	np.Spec = networkingv1.NetworkPolicySpec{
+		PodSelector: *podsOf(bestie, appPods, canaryPods, maintenancePods),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress:     ingress,
+	}
+}
+
+// setEgressPolicy lets the app and the migration Job only connect to the
+// database, to DNS and to the allowed networks.
+func setEgressPolicy(np *networkingv1.NetworkPolicy, bestie *petsv2.Bestie) {
+	udp := corev1.ProtocolUDP
+	dns := intstr.FromInt(53)
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{
+			To:    []networkingv1.NetworkPolicyPeer{{PodSelector: databasePods(bestie)}},
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(postgresPort))},
+		},
+		{
+			To:    []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}},
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, tcpPort(dns)},
+		},
+	}
+	var allowed []networkingv1.NetworkPolicyPeer
+	for _, cidr := range bestie.Spec.NetworkPolicy.Egress.AllowedCIDRs {
+		allowed = append(allowed, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	if len(allowed) > 0 {
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{To: allowed})
+	}
+	np.Spec = networkingv1.NetworkPolicySpec{
+		PodSelector: *podsOf(bestie, appPods, canaryPods, migrationPods),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		Egress:      egress,
+	}
+}
+
+// ingressNamespaces returns the selector of the namespaces the app is
+// reached through.
+func (r *BestieReconciler) ingressNamespaces(bestie *petsv2.Bestie) *metav1.LabelSelector {
+	if s := bestie.Spec.NetworkPolicy.IngressNamespaceSelector; s != nil {
+		return s.DeepCopy()
+	}
+	if r.Platform.OpenShift {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{openShiftPolicyGroupLabel: "ingress"}}
+	}
+	return &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: "ingress-nginx"}}
+}
+
+// monitoringNamespaces returns the selector of the namespaces of the
+// Prometheus scraping the stack.
+func (r *BestieReconciler) monitoringNamespaces(bestie *petsv2.Bestie) *metav1.LabelSelector {
+	if s := bestie.Spec.NetworkPolicy.MonitoringNamespaceSelector; s != nil {
+		return s.DeepCopy()
+	}
+	if r.Platform.OpenShift {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{openShiftPolicyGroupLabel: "monitoring"}}
+	}
+	return &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: "monitoring"}}
+}
+
+// databasePods selects the pods PGO runs for the database of bestie.
+func databasePods(bestie *petsv2.Bestie) *metav1.LabelSelector {
+	return &metav1.LabelSelector{MatchLabels: map[string]string{pgoClusterLabel: bestie.Name + "-pgo"}}
+}
+
+// podsOf selects the pods of bestie with one of the given "app" labels.
+func podsOf(bestie *petsv2.Bestie, apps ...string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchLabels:      map[string]string{LabelInstance: bestie.Name},
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: apps}},
+	}
+}
+
+// tcpPort returns the TCP port of a NetworkPolicy rule.
+func tcpPort(port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	tcp := corev1.ProtocolTCP
+	return networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &port}
+}
+
+// setPodLabels labels the pods of the template as pods of bestie, which is
+// what the NetworkPolicies select them by.
+func setPodLabels(template *corev1.PodTemplateSpec, bestie *petsv2.Bestie, app string) {
+	template.Labels = mergeLabels(template.Labels, labelsFor(bestie), map[string]string{"app": app})
+}
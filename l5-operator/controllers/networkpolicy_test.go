@@ -0,0 +1,105 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileNetworkPolicies(t *testing.T) {
+	g := NewWithT(t)
+	// The manifests are read relative to the module root.
+	wd, err := os.Getwd()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.Chdir("..")).To(Succeed())
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(petsv2.AddToScheme(scheme)).To(Succeed())
+
+	bestie := &petsv2.Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", UID: "bestie-uid"},
+		Spec:       petsv2.BestieSpec{NetworkPolicy: petsv2.NetworkPolicySpec{Enabled: true}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &BestieReconciler{Client: c, Scheme: scheme}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bestie", Namespace: "pets"}}
+	ctx := context.Background()
+	policies := func() map[string]networkingv1.NetworkPolicySpec {
+		list := &networkingv1.NetworkPolicyList{}
+		g.Expect(c.List(ctx, list)).To(Succeed())
+		specs := map[string]networkingv1.NetworkPolicySpec{}
+		for _, np := range list.Items {
+			specs[np.Name] = np.Spec
+		}
+		return specs
+	}
+	selects := func(selector metav1.LabelSelector, podLabels map[string]string) bool {
+		s, err := metav1.LabelSelectorAsSelector(&selector)
+		g.Expect(err).NotTo(HaveOccurred())
+		return s.Matches(labels.Set(podLabels))
+	}
+
+	g.Expect(r.reconcileNetworkPolicies(ctx, req, bestie)).To(Succeed())
+	specs := policies()
+	g.Expect(specs).To(HaveLen(2))
+
+	// The database is reached by the app, canary and migration pods of this
+	// Bestie only.
+	db := specs["bestie-database-policy"]
+	g.Expect(selects(db.PodSelector, map[string]string{pgoClusterLabel: "bestie-pgo"})).To(BeTrue())
+	app := &corev1.PodTemplateSpec{}
+	setPodLabels(app, bestie, appPods)
+	g.Expect(selects(*db.Ingress[1].From[0].PodSelector, app.Labels)).To(BeTrue())
+	g.Expect(selects(*db.Ingress[1].From[0].PodSelector, map[string]string{"app": appPods, LabelInstance: "other"})).To(BeFalse())
+	g.Expect(selects(*db.Ingress[1].From[0].PodSelector, canaryLabels(bestie))).To(BeTrue())
+
+	// The app is reached through the ingress controller and, with a
+	// LoadBalancer Service, from anywhere on its http port.
+	appPolicy := specs["bestie-app-policy"]
+	g.Expect(selects(appPolicy.PodSelector, app.Labels)).To(BeTrue())
+	g.Expect(appPolicy.Ingress[0].From[0].NamespaceSelector.MatchLabels).To(HaveKeyWithValue(corev1.LabelMetadataName, "ingress-nginx"))
+	g.Expect(appPolicy.Ingress).To(HaveLen(2))
+	bestie.Spec.Expose.Service.Type = corev1.ServiceTypeLoadBalancer
+	bestie.Spec.NetworkPolicy.Egress = &petsv2.EgressPolicySpec{Enabled: true, AllowedCIDRs: []string{"203.0.113.0/24"}}
+	g.Expect(r.reconcileNetworkPolicies(ctx, req, bestie)).To(Succeed())
+	specs = policies()
+	g.Expect(specs["bestie-app-policy"].Ingress).To(HaveLen(3))
+	g.Expect(specs["bestie-app-policy"].Ingress[2].From).To(BeEmpty())
+	g.Expect(specs["bestie-egress-policy"].Egress).To(HaveLen(3))
+	g.Expect(specs["bestie-egress-policy"].Egress[2].To[0].IPBlock.CIDR).To(Equal("203.0.113.0/24"))
+
+	// Disabling them removes them.
+	bestie.Spec.NetworkPolicy.Enabled = false
+	g.Expect(r.reconcileNetworkPolicies(ctx, req, bestie)).To(Succeed())
+	g.Expect(policies()).To(BeEmpty())
+}
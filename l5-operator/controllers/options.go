@@ -0,0 +1,107 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+)
+
+// ControllerOptions tunes how many Besties are reconciled at once and how
+// quickly failed reconciles are retried.
+type ControllerOptions struct {
+	// MaxConcurrentReconciles is the number of Besties reconciled in parallel.
+	MaxConcurrentReconciles int
+	// RetryBaseDelay is the delay before retrying a failed reconcile. It
+	// doubles with every further failure of the same Bestie.
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the retry delay of a single Bestie.
+	RetryMaxDelay time.Duration
+	// RetryQPS and RetryBurst limit the retries of all Besties together.
+	RetryQPS   float64
+	RetryBurst int
+}
+
+// BindFlags binds the controller options to the given flagset. The defaults
+// are those of controller-runtime.
+func (o *ControllerOptions) BindFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.MaxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of Besties reconciled in parallel.")
+	fs.DurationVar(&o.RetryBaseDelay, "workqueue-base-delay", 5*time.Millisecond,
+		"The delay before retrying a failed reconcile, doubled with every further failure of the same Bestie.")
+	fs.DurationVar(&o.RetryMaxDelay, "workqueue-max-delay", 1000*time.Second,
+		"The longest delay before retrying a failed reconcile of a Bestie.")
+	fs.Float64Var(&o.RetryQPS, "workqueue-qps", 10,
+		"The overall number of reconcile retries per second.")
+	fs.IntVar(&o.RetryBurst, "workqueue-burst", 100,
+		"The number of reconcile retries allowed above workqueue-qps in a burst.")
+}
+
+// rateLimiter returns the workqueue rate limiter of the options, built like
+// the controller-runtime default one. It returns nil, which selects that
+// default, when the options were not bound to flags.
+func (o ControllerOptions) rateLimiter() ratelimiter.RateLimiter {
+	if o.RetryBaseDelay == 0 {
+		return nil
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(o.RetryBaseDelay, o.RetryMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(o.RetryQPS), o.RetryBurst)},
+	)
+}
+
+// backoff hands out exponentially growing requeue delays per Bestie for the
+// waits that watches usually end first, so that a Bestie stuck waiting is
+// polled less and less often.
+type backoff struct {
+	mu       sync.Mutex
+	attempts map[types.NamespacedName]int
+}
+
+// next returns the delay before polling the Bestie at key again: base on the
+// first wait, doubling on each following one up to max.
+func (b *backoff) next(key types.NamespacedName, base, max time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.attempts == nil {
+		b.attempts = map[types.NamespacedName]int{}
+	}
+	delay := base
+	for i := 0; i < b.attempts[key] && delay < max; i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	if delay < max {
+		b.attempts[key]++
+	}
+	return delay
+}
+
+// reset starts the delays of the Bestie at key over, once it stops waiting.
+func (b *backoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.attempts, key)
+}
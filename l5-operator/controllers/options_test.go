@@ -0,0 +1,44 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestBackoff(t *testing.T) {
+	g := NewWithT(t)
+	b := &backoff{}
+	bestie := types.NamespacedName{Namespace: "pets", Name: "bestie"}
+	other := types.NamespacedName{Namespace: "pets", Name: "other"}
+
+	var delays []time.Duration
+	for i := 0; i < 6; i++ {
+		delays = append(delays, b.next(bestie, 5*time.Second, time.Minute))
+	}
+	g.Expect(delays).To(Equal([]time.Duration{
+		5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute,
+	}))
+	g.Expect(b.next(other, 5*time.Second, time.Minute)).To(Equal(5 * time.Second))
+
+	b.reset(bestie)
+	g.Expect(b.next(bestie, 5*time.Second, time.Minute)).To(Equal(5 * time.Second))
+}
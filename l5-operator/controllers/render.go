@@ -0,0 +1,99 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The manifests the components of a Bestie are rendered from, relative to
+// the working directory of the operator.
+const (
+	postgresClusterManifest       = "config/resources/postgrescluster.yaml"
+	appDeploymentManifest         = "config/resources/bestie-deploy.yaml"
+	autoscalerManifest            = "config/resources/bestie-hpa.yaml"
+	migrationJobManifest          = "config/resources/bestie-job.yaml"
+	serviceManifest               = "config/resources/bestie-svc.yaml"
+	routeManifest                 = "config/resources/bestie-route.yaml"
+	ingressManifest               = "config/resources/bestie-ingress.yaml"
+	maintenanceConfigMapManifest  = "config/resources/maintenance-cm.yaml"
+	maintenanceDeploymentManifest = "config/resources/maintenance-deploy.yaml"
+	certificateManifest           = "config/resources/bestie-certificate.yaml"
+	httpRouteManifest             = "config/resources/bestie-httproute.yaml"
+	networkPolicyManifest         = "config/resources/bestie-networkpolicy.yaml"
+)
+
+// Render returns the objects Reconcile creates for bestie at now, in the
+// order it creates them, without reading from or writing to the cluster.
+// They are built by the same desired components as in Reconcile and show
+// the stack once the app is up: the migration Job is included although
+// Reconcile only creates it after the app is ready. What Reconcile reads
+// from the cluster is left out: the config hash of the app pods and the
+// certificate a Route embeds. Only r.Scheme, r.Defaults and r.Platform are
+// used.
+func (r *BestieReconciler) Render(ctx context.Context, bestie *petsv2.Bestie, now time.Time) ([]client.Object, error) {
+	hibernating, _, err := hibernationState(bestie, now)
+	if err != nil {
+		return nil, err
+	}
+	maintenance := bestie.Spec.Maintenance.Enabled && !hibernating
+
+	components := []component{r.desiredPostgresCluster(bestie, hibernating)}
+	policies := r.desiredNetworkPolicies(bestie)
+	for _, suffix := range networkPolicySuffixes {
+		if c, ok := policies[suffix]; ok {
+			components = append(components, c)
+		}
+	}
+
+	components = append(components, r.desiredAppDeployment(ctx, bestie, hibernating, true))
+	if bestie.Spec.App.Autoscaling.Enabled && !maintenance && !hibernating {
+		components = append(components, desiredAutoscaler(bestie))
+	}
+	if maintenance {
+		components = append(components, r.desiredMaintenancePage(bestie)...)
+	}
+	if !maintenance && !hibernating {
+		components = append(components, r.desiredMigrationJob(bestie))
+	}
+	components = append(components, r.desiredService(bestie, maintenance))
+
+	public, serving := r.desiredCertificates(bestie)
+	for _, c := range []*component{public, serving} {
+		if c != nil {
+			components = append(components, *c)
+		}
+	}
+	exposure, err := r.desiredExposure(bestie, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	components = append(components, exposure)
+
+	objs := make([]client.Object, 0, len(components))
+	for _, c := range components {
+		if err := r.renderManifest(ctx, bestie, c.obj, c.manifest, c.mutate); err != nil {
+			return nil, err
+		}
+		objs = append(objs, c.obj)
+	}
+	return objs, nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// configHashAnnotation is the annotation of the app pod template holding
+// the hash of the Secrets and ConfigMaps the pods read, so that the pods
+// restart when one of them changes, e.g. when PGO rotates the password of
+// the database user.
+const configHashAnnotation = "bestie.com/config-hash"
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+// setRestartedAt copies the bestie.com/restartedAt annotation of the Bestie
+// to the pod template, which restarts the pods whenever it changes.
+func setRestartedAt(template *corev1.PodTemplateSpec, bestie *petsv2.Bestie) {
+	setTemplateAnnotation(template, petsv2.RestartedAtAnnotation, bestie.GetAnnotations()[petsv2.RestartedAtAnnotation])
+}
+
+// setTemplateAnnotation sets the annotation key of the pod template to
+// value, or removes it when value is empty.
+func setTemplateAnnotation(template *corev1.PodTemplateSpec, key, value string) {
+	if value == "" {
+		delete(template.Annotations, key)
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[key] = value
+}
+
+// stampConfigHash records on the pod template the hash of the Secrets and
+// ConfigMaps its pods read.
+func (r *BestieReconciler) stampConfigHash(ctx context.Context, bestie *petsv2.Bestie, template *corev1.PodTemplateSpec) error {
+	hash, err := r.configHash(ctx, bestie.Namespace, &template.Spec)
+	if err != nil {
+		return err
+	}
+	setTemplateAnnotation(template, configHashAnnotation, hash)
+	return nil
+}
+
+// configHash returns a hash of the contents of the Secrets and ConfigMaps
+// the pod spec references, or "" when it references none. A missing object
+// is hashed as such, so that its creation restarts the pods too. They are
+// read through the APIReader as they may not be labelled for the cache.
+// Only labelled Secrets and ConfigMaps are watched: changes to the others
+// are picked up on the next reconcile, at the latest after the Ready
+// requeue interval.
+func (r *BestieReconciler) configHash(ctx context.Context, namespace string, spec *corev1.PodSpec) (string, error) {
+	secrets, configMaps := referencedConfig(spec)
+	if len(secrets) == 0 && len(configMaps) == 0 {
+		return "", nil
+	}
+	h := sha256.New()
+	for _, name := range secrets {
+		secret := &corev1.Secret{}
+		if err := r.reader().Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil && !apierrors.IsNotFound(err) {
+			return "", err
+		}
+		fmt.Fprintf(h, "secret/%s\n", name)
+		hashData(h, secret.Data)
+	}
+	for _, name := range configMaps {
+		cm := &corev1.ConfigMap{}
+		if err := r.reader().Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, cm); err != nil && !apierrors.IsNotFound(err) {
+			return "", err
+		}
+		fmt.Fprintf(h, "configmap/%s\n", name)
+		data := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range cm.BinaryData {
+			data[k] = v
+		}
+		hashData(h, data)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hashData writes the entries of data to h in key order.
+func hashData(h interface{ Write([]byte) (int, error) }, data map[string][]byte) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%d:", k, len(data[k]))
+		_, _ = h.Write(data[k])
+	}
+}
+
+// referencedConfig returns the sorted names of the Secrets and ConfigMaps the
+// containers and volumes of the pod spec read.
+func referencedConfig(spec *corev1.PodSpec) (secrets, configMaps []string) {
+	secretSet, configMapSet := map[string]bool{}, map[string]bool{}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, env := range c.Env {
+			if from := env.ValueFrom; from != nil {
+				if from.SecretKeyRef != nil {
+					secretSet[from.SecretKeyRef.Name] = true
+				}
+				if from.ConfigMapKeyRef != nil {
+					configMapSet[from.ConfigMapKeyRef.Name] = true
+				}
+			}
+		}
+		for _, from := range c.EnvFrom {
+			if from.SecretRef != nil {
+				secretSet[from.SecretRef.Name] = true
+			}
+			if from.ConfigMapRef != nil {
+				configMapSet[from.ConfigMapRef.Name] = true
+			}
+		}
+	}
+	for _, v := range spec.Volumes {
+		if v.Secret != nil {
+			secretSet[v.Secret.SecretName] = true
+		}
+		if v.ConfigMap != nil {
+			configMapSet[v.ConfigMap.Name] = true
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.Secret != nil {
+					secretSet[source.Secret.Name] = true
+				}
+				if source.ConfigMap != nil {
+					configMapSet[source.ConfigMap.Name] = true
+				}
+			}
+		}
+	}
+	return sortedKeys(secretSet), sortedKeys(configMapSet)
+}
+
+// sortedKeys returns the keys of set in order.
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
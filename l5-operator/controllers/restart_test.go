@@ -0,0 +1,120 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStampConfigHash(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-pgo-pguser-bestie-pgo", Namespace: "pets"},
+		Data:       map[string][]byte{"password": []byte("first")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+	r := &BestieReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+	bestie := &petsv2.Bestie{ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets"}}
+
+	template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: appPods, Env: []corev1.EnvVar{{
+			Name: "DB_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name}, Key: "password",
+			}},
+		}}}},
+		Volumes: []corev1.Volume{{Name: "settings", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "bestie-settings"}},
+		}}},
+	}}
+	secrets, configMaps := referencedConfig(&template.Spec)
+	g.Expect(secrets).To(Equal([]string{secret.Name}))
+	g.Expect(configMaps).To(Equal([]string{"bestie-settings"}))
+
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	first := template.Annotations[configHashAnnotation]
+	g.Expect(first).NotTo(BeEmpty())
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	g.Expect(template.Annotations[configHashAnnotation]).To(Equal(first))
+
+	// Rotating the password restarts the pods, and so does creating the
+	// missing ConfigMap.
+	secret.Data["password"] = []byte("second")
+	g.Expect(c.Update(ctx, secret)).To(Succeed())
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	second := template.Annotations[configHashAnnotation]
+	g.Expect(second).NotTo(Equal(first))
+	g.Expect(c.Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-settings", Namespace: "pets"},
+		Data:       map[string]string{"theme": "dark"},
+	})).To(Succeed())
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	g.Expect(template.Annotations[configHashAnnotation]).NotTo(Equal(second))
+
+	// A Secret of the user does not carry the operator's labels, so only the
+	// APIReader sees it.
+	api := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-settings", Namespace: "pets"},
+		Data:       map[string][]byte{"token": []byte("first")},
+	}).Build()
+	r = &BestieReconciler{Client: labelScopedClient{api}, APIReader: api, Scheme: scheme}
+	template.Spec = corev1.PodSpec{Containers: []corev1.Container{{Name: appPods, EnvFrom: []corev1.EnvFromSource{{
+		SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "user-settings"}},
+	}}}}}
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	third := template.Annotations[configHashAnnotation]
+	user := &corev1.Secret{}
+	g.Expect(api.Get(ctx, types.NamespacedName{Name: "user-settings", Namespace: "pets"}, user)).To(Succeed())
+	user.Data["token"] = []byte("second")
+	g.Expect(api.Update(ctx, user)).To(Succeed())
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	g.Expect(template.Annotations[configHashAnnotation]).NotTo(Equal(third))
+
+	// Without references there is nothing to hash.
+	template.Spec = corev1.PodSpec{Containers: []corev1.Container{{Name: appPods}}}
+	g.Expect(r.stampConfigHash(ctx, bestie, template)).To(Succeed())
+	g.Expect(template.Annotations).NotTo(HaveKey(configHashAnnotation))
+}
+
+func TestSetRestartedAt(t *testing.T) {
+	g := NewWithT(t)
+	bestie := &petsv2.Bestie{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{petsv2.RestartedAtAnnotation: "2022-03-01T12:00:00Z"},
+	}}
+	template := &corev1.PodTemplateSpec{}
+
+	setRestartedAt(template, bestie)
+	g.Expect(template.Annotations).To(HaveKeyWithValue(petsv2.RestartedAtAnnotation, "2022-03-01T12:00:00Z"))
+
+	bestie.Annotations = nil
+	setRestartedAt(template, bestie)
+	g.Expect(template.Annotations).NotTo(HaveKey(petsv2.RestartedAtAnnotation))
+}
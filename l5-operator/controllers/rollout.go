@@ -0,0 +1,476 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// canaryPods is the value of the "app" label of the pods running the
+	// new version during a rollout, which the canary Service selects.
+	canaryPods = "bestie-canary"
+
+	// The annotations of the canary Deployment holding the state of the
+	// rollout.
+	rolloutRevisionAnnotation    = "bestie.com/rollout-revision"
+	rolloutPhaseAnnotation       = "bestie.com/rollout-phase"
+	rolloutStepAnnotation        = "bestie.com/rollout-step"
+	rolloutStepStartedAnnotation = "bestie.com/rollout-step-started-at"
+	rolloutWeightAnnotation      = "bestie.com/rollout-weight"
+	rolloutMessageAnnotation     = "bestie.com/rollout-message"
+
+	// The annotations of the app Deployment recording the revision whose
+	// rollout was aborted, and why.
+	rolloutAbortedAnnotation        = "bestie.com/rollout-aborted"
+	rolloutAbortedMessageAnnotation = "bestie.com/rollout-aborted-message"
+)
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+
+// rollingOut returns whether changes of the app of bestie are rolled out
+// next to the app Deployment. That takes the Canary or BlueGreen strategy
+// and an app serving traffic through a Route or an HTTPRoute.
+func (r *BestieReconciler) rollingOut(bestie *petsv2.Bestie, maintenance, hibernating bool) bool {
+	t := r.exposeType(bestie)
+	return bestie.Spec.Rollout.Progressive() && (t == petsv2.ExposeRoute || t == petsv2.ExposeGateway) &&
+		!maintenance && !hibernating
+}
+
+// rolloutState is the state of a rollout, kept in the annotations of the
+// canary Deployment.
+type rolloutState struct {
+	revision  string
+	phase     petsv2.RolloutPhase
+	step      int
+	startedAt time.Time
+	weight    int32
+	message   string
+}
+
+// canaryState returns the state of the rollout the canary Deployment runs,
+// the zero state when there is none.
+func canaryState(canary *appsv1.Deployment) rolloutState {
+	if canary == nil {
+		return rolloutState{}
+	}
+	annotations := canary.GetAnnotations()
+	state := rolloutState{
+		revision: annotations[rolloutRevisionAnnotation],
+		phase:    petsv2.RolloutPhase(annotations[rolloutPhaseAnnotation]),
+		message:  annotations[rolloutMessageAnnotation],
+	}
+	state.step, _ = strconv.Atoi(annotations[rolloutStepAnnotation])
+	state.startedAt, _ = time.Parse(time.RFC3339, annotations[rolloutStepStartedAnnotation])
+	if weight, err := strconv.ParseInt(annotations[rolloutWeightAnnotation], 10, 32); err == nil {
+		state.weight = int32(weight)
+	}
+	return state
+}
+
+// annotate records the state in the annotations of the canary Deployment.
+func (s rolloutState) annotate(canary *appsv1.Deployment) {
+	annotations := canary.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[rolloutRevisionAnnotation] = s.revision
+	annotations[rolloutPhaseAnnotation] = string(s.phase)
+	annotations[rolloutStepAnnotation] = strconv.Itoa(s.step)
+	annotations[rolloutWeightAnnotation] = strconv.Itoa(int(s.weight))
+	if s.startedAt.IsZero() {
+		delete(annotations, rolloutStepStartedAnnotation)
+	} else {
+		annotations[rolloutStepStartedAnnotation] = s.startedAt.UTC().Format(time.RFC3339)
+	}
+	if s.message == "" {
+		delete(annotations, rolloutMessageAnnotation)
+	} else {
+		annotations[rolloutMessageAnnotation] = s.message
+	}
+	canary.SetAnnotations(annotations)
+}
+
+// templateRevision returns a hash identifying the app pod template rolled out.
+func templateRevision(template *corev1.PodTemplateSpec) string {
+	b, _ := json.Marshal(template)
+	h := fnv.New32a()
+	h.Write(b)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// holdsAppTemplate returns whether the app Deployment dp keeps its pod
+// template rather than taking desired, which is then rolled out next to it.
+// A new Deployment takes desired right away, and an existing one once the
+// canary running desired was promoted.
+func holdsAppTemplate(dp, canary *appsv1.Deployment, desired *corev1.PodTemplateSpec, rollingOut bool) bool {
+	if !rollingOut || dp.ResourceVersion == "" {
+		return false
+	}
+	state := canaryState(canary)
+	return state.phase != petsv2.RolloutPromoting || state.revision != templateRevision(desired)
+}
+
+// canaryDeployment returns the Deployment running the new version, or nil
+// when no rollout runs.
+func (r *BestieReconciler) canaryDeployment(ctx context.Context, bestie *petsv2.Bestie) (*appsv1.Deployment, error) {
+	canary := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-app-canary", Namespace: bestie.Namespace}, canary); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return canary, nil
+}
+
+// rollout is the outcome of a pass of reconcileRollout.
+type rollout struct {
+	// canaryWeight is the percentage of traffic to send to the new version.
+	canaryWeight int32
+	// requeueAfter is when to check on the rollout again.
+	requeueAfter time.Duration
+	// done tells to remove the new version, once no traffic goes to it.
+	done bool
+}
+
+// reconcileRollout rolls out the app pod template desired next to the app
+// Deployment with the Canary or BlueGreen strategy. Each step lasts
+// spec.rollout.stepDuration from the moment the new version is ready at its
+// scale. The rollout is aborted when the new version fails its checks, and
+// the new version promoted once it passed the last step. Without a rollout
+// to run the result is done.
+func (r *BestieReconciler) reconcileRollout(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie, desired *corev1.PodTemplateSpec, rollingOut bool, now time.Time) (rollout, error) {
+	log := ctrllog.FromContext(ctx)
+
+	app := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-app", Namespace: bestie.Namespace}, app); err != nil {
+		return rollout{}, err
+	}
+	canary, err := r.canaryDeployment(ctx, bestie)
+	if err != nil {
+		return rollout{}, err
+	}
+
+	if !rollingOut || equality.Semantic.DeepEqual(app.Spec.Template, *desired) {
+		if rollingOut && canary != nil && !rolledOut(app) {
+			// Promoted: the new version keeps the traffic until the app
+			// Deployment runs it too.
+			log.Info("Waiting for bestie-app to roll out the promoted version")
+			return rollout{canaryWeight: 100, requeueAfter: r.waitDelay(req)}, nil
+		}
+		return rollout{done: true}, r.clearAbortedRollout(ctx, app)
+	}
+
+	revision := templateRevision(desired)
+	if app.Annotations[rolloutAbortedAnnotation] == revision {
+		return rollout{done: true}, nil
+	}
+
+	state := canaryState(canary)
+	running := canary != nil && state.revision == revision
+	if !running {
+		if canary != nil {
+			log.Info("Restarting the rollout for another version of the app")
+		}
+		state = rolloutState{revision: revision, phase: petsv2.RolloutProgressing}
+	}
+	if running {
+		reason, err := r.canaryFailure(ctx, bestie, canary)
+		if err != nil {
+			return rollout{}, err
+		}
+		if reason != "" {
+			return rollout{done: true}, r.abortRollout(ctx, app, canary, revision, reason)
+		}
+	}
+
+	steps := bestie.Spec.Rollout.EffectiveSteps()
+	if state.step >= len(steps) {
+		state.step = len(steps) - 1
+	}
+	var delay time.Duration
+	switch {
+	case state.phase == petsv2.RolloutPromoting:
+		state.weight = 100
+		delay = r.waitDelay(req)
+	case !running || !rolledOut(canary):
+		// Traffic follows once the new version is ready at its new scale.
+		state.weight = 0
+		if state.step > 0 {
+			state.weight = steps[state.step-1]
+		}
+		delay = r.waitDelay(req)
+	default:
+		state.weight = steps[state.step]
+		if state.startedAt.IsZero() {
+			log.Info("Shifting traffic to the new version of the app", "weight", state.weight)
+			state.startedAt = now
+		}
+		stepDuration := bestie.Spec.Rollout.EffectiveStepDuration()
+		remaining := stepDuration - now.Sub(state.startedAt)
+		var waiting bool
+		if analysis := bestie.Spec.Rollout.Analysis; remaining <= 0 && analysis != nil {
+			// The step is over: the new version goes on only if its
+			// metrics are not worse than those of the current one.
+			reason, summary, err := r.analyzeRollout(ctx, bestie, now)
+			switch {
+			case err != nil:
+				// Without metrics, or while the metrics API fails, the
+				// step is held for up to one more interval before the
+				// rollout is aborted.
+				failure := err.Error()
+				state.message = "Waiting for metrics of the new version"
+				if !errors.Is(err, errNoMetrics) {
+					log.Error(err, "Failed to analyse the rollout")
+					failure = "the analysis failed: " + failure
+					state.message = "Retrying the analysis: " + err.Error()
+				}
+				if -remaining >= analysis.EffectiveInterval(stepDuration) {
+					return rollout{done: true}, r.abortRollout(ctx, app, canary, revision, failure)
+				}
+				waiting = true
+			case reason != "":
+				return rollout{done: true}, r.abortRollout(ctx, app, canary, revision, reason)
+			default:
+				state.message = summary
+			}
+		}
+		switch {
+		case remaining > 0:
+			delay = remaining
+		case waiting:
+			delay = r.waitDelay(req)
+		case state.step+1 < len(steps):
+			state.step++
+			state.startedAt = time.Time{}
+			delay = r.waitDelay(req)
+		default:
+			log.Info("Promoting the new version of the app", "revision", revision)
+			state.phase = petsv2.RolloutPromoting
+			delay = r.waitDelay(req)
+		}
+	}
+
+	replicas := canaryReplicas(bestie, app, steps[state.step])
+	dp := &appsv1.Deployment{}
+	if err := r.reconcileComponent(ctx, req, bestie, "CanaryDeployment", dp, "-app-canary", appDeploymentManifest, func() error {
+		setCanaryDeployment(dp, bestie, desired, replicas, state)
+		return nil
+	}); err != nil {
+		return rollout{}, err
+	}
+	svc := &corev1.Service{}
+	if err := r.reconcileComponent(ctx, req, bestie, "CanaryService", svc, "-service-canary", serviceManifest, func() error {
+		r.setCanaryService(svc, bestie)
+		return nil
+	}); err != nil {
+		return rollout{}, err
+	}
+	return rollout{canaryWeight: state.weight, requeueAfter: delay}, nil
+}
+
+// canaryReplicas returns the replicas of the new version: as many as the app
+// runs with BlueGreen, and their share of the traffic with Canary.
+func canaryReplicas(bestie *petsv2.Bestie, app *appsv1.Deployment, weight int32) int32 {
+	replicas := bestie.Spec.App.Replicas
+	if app.Spec.Replicas != nil {
+		replicas = *app.Spec.Replicas
+	}
+	if bestie.Spec.Rollout.Strategy == petsv2.RolloutCanary {
+		replicas = (replicas*weight + 99) / 100
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	return replicas
+}
+
+// setCanaryDeployment makes the canary Deployment run the pod template
+// desired at the given scale, with pods the canary Service selects, and
+// records the state of the rollout.
+func setCanaryDeployment(dp *appsv1.Deployment, bestie *petsv2.Bestie, desired *corev1.PodTemplateSpec, replicas int32, state rolloutState) {
+	dp.SetName(bestie.Name + "-app-canary")
+	dp.Spec.Replicas = &replicas
+	dp.Spec.Selector = &metav1.LabelSelector{MatchLabels: canaryLabels(bestie)}
+	template := desired.DeepCopy()
+	template.Labels = mergeLabels(template.Labels, labelsFor(bestie), canaryLabels(bestie))
+	dp.Spec.Template = *template
+	state.annotate(dp)
+}
+
+// setCanaryService points the canary Service at the pods of the new version.
+// It is only reached through the Route or HTTPRoute.
+func (r *BestieReconciler) setCanaryService(svc *corev1.Service, bestie *petsv2.Bestie) {
+	svc.SetName(bestie.Name + "-service-canary")
+	r.setService(svc, bestie, false)
+	svc.Spec.Selector = canaryLabels(bestie)
+	svc.Spec.Type = corev1.ServiceTypeClusterIP
+	svc.Spec.LoadBalancerSourceRanges = nil
+	for i := range svc.Spec.Ports {
+		svc.Spec.Ports[i].NodePort = 0
+	}
+}
+
+// canaryLabels returns the labels of the pods of the new version.
+func canaryLabels(bestie *petsv2.Bestie) map[string]string {
+	return map[string]string{"app": canaryPods, LabelInstance: bestie.Name}
+}
+
+// rolledOut returns whether every replica of the Deployment runs its
+// current pod template and is available.
+func rolledOut(dp *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if dp.Spec.Replicas != nil {
+		replicas = *dp.Spec.Replicas
+	}
+	return dp.Status.ObservedGeneration >= dp.Generation &&
+		dp.Status.Replicas == replicas &&
+		dp.Status.UpdatedReplicas == replicas &&
+		dp.Status.AvailableReplicas == replicas
+}
+
+// canaryFailure returns why the new version fails its checks, or "" while
+// it passes them: it must become ready within its progress deadline, and
+// its containers must not restart more than spec.rollout.maxRestarts times.
+func (r *BestieReconciler) canaryFailure(ctx context.Context, bestie *petsv2.Bestie, canary *appsv1.Deployment) (string, error) {
+	for _, cond := range canary.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return "the new version did not become ready within its progress deadline", nil
+		}
+	}
+
+	// Pods are not in the cache.
+	pods := &corev1.PodList{}
+	if err := r.reader().List(ctx, pods, client.InNamespace(bestie.Namespace), client.MatchingLabels(canaryLabels(bestie))); err != nil {
+		return "", err
+	}
+	var restarts int32
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts += status.RestartCount
+		}
+	}
+	if restarts > bestie.Spec.Rollout.MaxRestarts {
+		return fmt.Sprintf("the containers of the new version restarted %d times", restarts), nil
+	}
+	return "", nil
+}
+
+// abortRollout records on the app Deployment that the revision was aborted,
+// so that it is not rolled out again until the app spec changes.
+func (r *BestieReconciler) abortRollout(ctx context.Context, app, canary *appsv1.Deployment, revision, reason string) error {
+	image := ""
+	if containers := canary.Spec.Template.Spec.Containers; len(containers) > 0 {
+		image = containers[0].Image
+	}
+	ctrllog.FromContext(ctx).Info("Aborting the rollout of the new version of the app", "image", image, "reason", reason)
+
+	annotations := app.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[rolloutAbortedAnnotation] = revision
+	annotations[rolloutAbortedMessageAnnotation] = fmt.Sprintf("The rollout of %s was aborted: %s", image, reason)
+	app.SetAnnotations(annotations)
+	return r.Update(ctx, app)
+}
+
+// clearAbortedRollout forgets the aborted rollout recorded on the app
+// Deployment, once it runs the app spec again.
+func (r *BestieReconciler) clearAbortedRollout(ctx context.Context, app *appsv1.Deployment) error {
+	annotations := app.GetAnnotations()
+	if _, ok := annotations[rolloutAbortedAnnotation]; !ok {
+		return nil
+	}
+	delete(annotations, rolloutAbortedAnnotation)
+	delete(annotations, rolloutAbortedMessageAnnotation)
+	app.SetAnnotations(annotations)
+	return r.Update(ctx, app)
+}
+
+// removeCanary removes the Deployment and Service of the new version.
+func (r *BestieReconciler) removeCanary(ctx context.Context, bestie *petsv2.Bestie) error {
+	if err := r.removeComponent(ctx, bestie, "CanaryDeployment", &appsv1.Deployment{}, "-app-canary"); err != nil {
+		return err
+	}
+	return r.removeComponent(ctx, bestie, "CanaryService", &corev1.Service{}, "-service-canary")
+}
+
+// rolloutStatus reports the rollout of the app, or nil with the
+// RollingUpdate strategy.
+func (r *BestieReconciler) rolloutStatus(ctx context.Context, bestie *petsv2.Bestie) *petsv2.RolloutStatus {
+	if !bestie.Spec.Rollout.Progressive() {
+		return nil
+	}
+	status := &petsv2.RolloutStatus{Phase: petsv2.RolloutStable, StableWeight: 100}
+	if canary, err := r.canaryDeployment(ctx, bestie); err == nil && canary != nil {
+		state := canaryState(canary)
+		status.Phase = state.phase
+		status.Step = int32(state.step)
+		status.CanaryWeight = state.weight
+		status.StableWeight = 100 - state.weight
+		status.Message = state.message
+		if containers := canary.Spec.Template.Spec.Containers; len(containers) > 0 {
+			status.Image = containers[0].Image
+		}
+		return status
+	}
+
+	app := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bestie.Name + "-app", Namespace: bestie.Namespace}, app); err != nil {
+		if !apierrors.IsNotFound(err) {
+			status.Message = err.Error()
+		}
+		return status
+	}
+	if app.Annotations[rolloutAbortedAnnotation] != "" {
+		status.Phase = petsv2.RolloutAborted
+		status.Message = app.Annotations[rolloutAbortedMessageAnnotation]
+	}
+	return status
+}
+
+// setRouteBackends splits the traffic of the Route between the bestie
+// Service and, with a weight above 0, the canary Service.
+func setRouteBackends(route *routev1.Route, bestie *petsv2.Bestie, canaryWeight int32) {
+	stableWeight := 100 - canaryWeight
+	route.Spec.To.Weight = &stableWeight
+	route.Spec.AlternateBackends = nil
+	if canaryWeight > 0 {
+		route.Spec.AlternateBackends = []routev1.RouteTargetReference{{
+			Kind:   "Service",
+			Name:   bestie.Name + "-service-canary",
+			Weight: &canaryWeight,
+		}}
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	configv1alpha1 "github.com/opdev/l5-operator-demo/l5-operator/api/config/v1alpha1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestReconcileRollout walks a canary rollout through its steps up to the
+// promotion, then aborts another one whose containers restart.
+func TestReconcileRollout(t *testing.T) {
+	g := NewWithT(t)
+	// The manifests are read relative to the module root.
+	wd, err := os.Getwd()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.Chdir("..")).To(Succeed())
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(petsv2.AddToScheme(scheme)).To(Succeed())
+
+	bestie := &petsv2.Bestie{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", UID: "bestie-uid"},
+		Spec: petsv2.BestieSpec{
+			App:     petsv2.AppSpec{Replicas: 4, Version: "1.2"},
+			Expose:  petsv2.ExposeSpec{Type: petsv2.ExposeRoute},
+			Rollout: petsv2.RolloutSpec{Strategy: petsv2.RolloutCanary, Steps: []int32{25}},
+		},
+	}
+	template := func(image string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": appPods}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: appPods, Image: image}}},
+		}
+	}
+	replicas := int32(4)
+	app := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-app", Namespace: "pets"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: template("quay.io/mkong/bestiev2:1.1")},
+		Status:     appsv1.DeploymentStatus{Replicas: 4, UpdatedReplicas: 4, AvailableReplicas: 4},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(app).Build()
+	r := &BestieReconciler{Client: c, Scheme: scheme, Defaults: configv1alpha1.BestieDefaults{AppImage: "quay.io/mkong/bestiev2"}}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bestie", Namespace: "pets"}}
+	ctx := context.Background()
+	desired := template("quay.io/mkong/bestiev2:1.2")
+	start := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	canary := &appsv1.Deployment{}
+	getCanary := func() *appsv1.Deployment {
+		g.Expect(c.Get(ctx, types.NamespacedName{Name: "bestie-app-canary", Namespace: "pets"}, canary)).To(Succeed())
+		return canary
+	}
+	markReady := func() {
+		canary := getCanary()
+		canary.Status = appsv1.DeploymentStatus{Replicas: *canary.Spec.Replicas, UpdatedReplicas: *canary.Spec.Replicas, AvailableReplicas: *canary.Spec.Replicas}
+		g.Expect(c.Update(ctx, canary)).To(Succeed())
+	}
+
+	g.Expect(holdsAppTemplate(app, nil, &desired, true)).To(BeTrue())
+
+	// The new version starts without traffic.
+	result, err := r.reconcileRollout(ctx, req, bestie, &desired, true, start)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.canaryWeight).To(BeZero())
+	g.Expect(*getCanary().Spec.Replicas).To(Equal(int32(1)))
+	g.Expect(canary.Spec.Template.Labels).To(HaveKeyWithValue("app", canaryPods))
+	g.Expect(canary.Spec.Template.Spec.Containers[0].Image).To(Equal("quay.io/mkong/bestiev2:1.2"))
+	svc := &corev1.Service{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "bestie-service-canary", Namespace: "pets"}, svc)).To(Succeed())
+	g.Expect(svc.Spec.Selector).To(Equal(canaryLabels(bestie)))
+
+	// Once ready it gets the first step, for the step duration.
+	markReady()
+	result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(rollout{canaryWeight: 25, requeueAfter: time.Minute}))
+
+	// Then all of it, once scaled up.
+	result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(time.Minute))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.canaryWeight).To(Equal(int32(25)))
+	g.Expect(*getCanary().Spec.Replicas).To(Equal(int32(4)))
+	markReady()
+	result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(2*time.Minute))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.canaryWeight).To(Equal(int32(100)))
+	g.Expect(r.rolloutStatus(ctx, bestie)).To(Equal(&petsv2.RolloutStatus{
+		Phase: petsv2.RolloutProgressing, Image: "quay.io/mkong/bestiev2:1.2", Step: 1, CanaryWeight: 100,
+	}))
+
+	// After the last step the new version is promoted.
+	result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(3*time.Minute))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.canaryWeight).To(Equal(int32(100)))
+	g.Expect(holdsAppTemplate(app, getCanary(), &desired, true)).To(BeFalse())
+
+	// The app Deployment takes the new version, which keeps the traffic
+	// until it is rolled out.
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(app), app)).To(Succeed())
+	app.Spec.Template = desired
+	app.Status.UpdatedReplicas = 0
+	g.Expect(c.Update(ctx, app)).To(Succeed())
+	result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(4*time.Minute))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.canaryWeight).To(Equal(int32(100)))
+	g.Expect(result.done).To(BeFalse())
+	app.Status.UpdatedReplicas = 4
+	g.Expect(c.Update(ctx, app)).To(Succeed())
+	result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(5*time.Minute))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(rollout{done: true}))
+	g.Expect(r.removeCanary(ctx, bestie)).To(Succeed())
+	g.Expect(r.rolloutStatus(ctx, bestie)).To(Equal(&petsv2.RolloutStatus{Phase: petsv2.RolloutStable, StableWeight: 100}))
+
+	// A new version whose containers restart is aborted, and not retried.
+	broken := template("quay.io/mkong/bestiev2:1.3")
+	_, err = r.reconcileRollout(ctx, req, bestie, &broken, true, start)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(c.Create(ctx, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bestie-app-canary-1", Namespace: "pets", Labels: canaryLabels(bestie)},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: appPods, RestartCount: 2}}},
+	})).To(Succeed())
+	result, err = r.reconcileRollout(ctx, req, bestie, &broken, true, start)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(rollout{done: true}))
+	g.Expect(r.removeCanary(ctx, bestie)).To(Succeed())
+	status := r.rolloutStatus(ctx, bestie)
+	g.Expect(status.Phase).To(Equal(petsv2.RolloutAborted))
+	g.Expect(status.Message).To(ContainSubstring("restarted 2 times"))
+	result, err = r.reconcileRollout(ctx, req, bestie, &broken, true, start)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(rollout{done: true}))
+}
+
+// noMetrics is a metrics API without data, as for a version getting no
+// traffic.
+type noMetrics struct{}
+
+func (noMetrics) Query(context.Context, string, time.Time) (float64, bool, error) {
+	return 0, false, nil
+}
+
+// failingMetrics is a metrics API that cannot be queried.
+type failingMetrics struct{}
+
+func (failingMetrics) Query(context.Context, string, time.Time) (float64, bool, error) {
+	return 0, false, errors.New("connection refused")
+}
+
+// TestReconcileRolloutWithoutMetrics holds a step whose analysis finds no
+// metrics, or cannot query them, for one more interval, then aborts the
+// rollout.
+func TestReconcileRolloutWithoutMetrics(t *testing.T) {
+	// The manifests are read relative to the module root.
+	wd, err := os.Getwd()
+	NewWithT(t).Expect(err).NotTo(HaveOccurred())
+	NewWithT(t).Expect(os.Chdir("..")).To(Succeed())
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	tests := []struct {
+		name        string
+		metrics     MetricsClient
+		wantWaiting string
+		wantAborted string
+	}{
+		{
+			name:        "no metrics",
+			metrics:     noMetrics{},
+			wantWaiting: "Waiting for metrics of the new version",
+			wantAborted: "no metrics of the new version",
+		},
+		{
+			name:        "failing metrics API",
+			metrics:     failingMetrics{},
+			wantWaiting: "Retrying the analysis: ",
+			wantAborted: "the analysis failed: ",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := runtime.NewScheme()
+			g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			g.Expect(petsv2.AddToScheme(scheme)).To(Succeed())
+
+			bestie := &petsv2.Bestie{
+				ObjectMeta: metav1.ObjectMeta{Name: "bestie", Namespace: "pets", UID: "bestie-uid"},
+				Spec: petsv2.BestieSpec{
+					App:    petsv2.AppSpec{Replicas: 4, Version: "1.2"},
+					Expose: petsv2.ExposeSpec{Type: petsv2.ExposeRoute},
+					Rollout: petsv2.RolloutSpec{
+						Strategy:     petsv2.RolloutCanary,
+						Steps:        []int32{25},
+						StepDuration: &metav1.Duration{Duration: 2 * time.Minute},
+						Analysis:     &petsv2.AnalysisSpec{Address: "http://prometheus:9090"},
+					},
+				},
+			}
+			template := func(image string) corev1.PodTemplateSpec {
+				return corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": appPods}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: appPods, Image: image}}},
+				}
+			}
+			replicas := int32(4)
+			app := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "bestie-app", Namespace: "pets"},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: template("quay.io/mkong/bestiev2:1.1")},
+				Status:     appsv1.DeploymentStatus{Replicas: 4, UpdatedReplicas: 4, AvailableReplicas: 4},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(app).Build()
+			r := &BestieReconciler{
+				Client: c, Scheme: scheme,
+				Defaults:         configv1alpha1.BestieDefaults{AppImage: "quay.io/mkong/bestiev2"},
+				NewMetricsClient: func(string, string) MetricsClient { return tt.metrics },
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bestie", Namespace: "pets"}}
+			ctx := context.Background()
+			desired := template("quay.io/mkong/bestiev2:1.2")
+			start := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+			_, err := r.reconcileRollout(ctx, req, bestie, &desired, true, start)
+			g.Expect(err).NotTo(HaveOccurred())
+			canary := &appsv1.Deployment{}
+			g.Expect(c.Get(ctx, types.NamespacedName{Name: "bestie-app-canary", Namespace: "pets"}, canary)).To(Succeed())
+			canary.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+			g.Expect(c.Update(ctx, canary)).To(Succeed())
+			result, err := r.reconcileRollout(ctx, req, bestie, &desired, true, start)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result.canaryWeight).To(Equal(int32(25)))
+
+			// At the end of the step the analysis is inconclusive: the step goes on.
+			result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(3*time.Minute))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result.done).To(BeFalse())
+			g.Expect(result.canaryWeight).To(Equal(int32(25)))
+			status := r.rolloutStatus(ctx, bestie)
+			g.Expect(status.Phase).To(Equal(petsv2.RolloutProgressing))
+			g.Expect(status.Message).To(HavePrefix(tt.wantWaiting))
+
+			// One interval later the rollout is aborted.
+			result, err = r.reconcileRollout(ctx, req, bestie, &desired, true, start.Add(4*time.Minute))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(rollout{done: true}))
+			g.Expect(r.removeCanary(ctx, bestie)).To(Succeed())
+			status = r.rolloutStatus(ctx, bestie)
+			g.Expect(status.Phase).To(Equal(petsv2.RolloutAborted))
+			g.Expect(status.Message).To(ContainSubstring(tt.wantAborted))
+		})
+	}
+}
+
+func TestSetRouteBackends(t *testing.T) {
+	g := NewWithT(t)
+	bestie := &petsv2.Bestie{ObjectMeta: metav1.ObjectMeta{Name: "bestie"}}
+	route := &routev1.Route{Spec: routev1.RouteSpec{To: routev1.RouteTargetReference{Kind: "Service", Name: "bestie-service"}}}
+
+	setRouteBackends(route, bestie, 25)
+	g.Expect(*route.Spec.To.Weight).To(Equal(int32(75)))
+	g.Expect(route.Spec.AlternateBackends).To(HaveLen(1))
+	g.Expect(route.Spec.AlternateBackends[0].Name).To(Equal("bestie-service-canary"))
+	g.Expect(*route.Spec.AlternateBackends[0].Weight).To(Equal(int32(25)))
+
+	setRouteBackends(route, bestie, 0)
+	g.Expect(*route.Spec.To.Weight).To(Equal(int32(100)))
+	g.Expect(route.Spec.AlternateBackends).To(BeNil())
+}
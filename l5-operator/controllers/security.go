@@ -0,0 +1,107 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultRunAsUser is the user the pods run as outside OpenShift, where
+	// the restricted SCC assigns one from the namespace range instead.
+	defaultRunAsUser = int64(1001)
+
+	// tmpVolume is the emptyDir the containers write to when their root
+	// filesystem is read-only.
+	tmpVolume = "tmp"
+	tmpPath   = "/tmp"
+)
+
+// setSecurityContext hardens the pods and every container of the spec so
+// that they pass the restricted Pod Security Standard, unless spec.app
+// replaces the security contexts.
+func (r *BestieReconciler) setSecurityContext(spec *corev1.PodSpec, bestie *petsv2.Bestie) {
+	spec.SecurityContext = r.podSecurityContext(bestie)
+	container := containerSecurityContext(bestie)
+	readOnly := container.ReadOnlyRootFilesystem != nil && *container.ReadOnlyRootFilesystem
+
+	volumes := spec.Volumes[:0]
+	for _, v := range spec.Volumes {
+		if v.Name != tmpVolume {
+			volumes = append(volumes, v)
+		}
+	}
+	if readOnly {
+		volumes = append(volumes, corev1.Volume{
+			Name:         tmpVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+	spec.Volumes = volumes
+
+	harden := func(c *corev1.Container) {
+		c.SecurityContext = container.DeepCopy()
+		mounts := c.VolumeMounts[:0]
+		for _, m := range c.VolumeMounts {
+			if m.Name != tmpVolume {
+				mounts = append(mounts, m)
+			}
+		}
+		if readOnly {
+			mounts = append(mounts, corev1.VolumeMount{Name: tmpVolume, MountPath: tmpPath})
+		}
+		c.VolumeMounts = mounts
+	}
+	for i := range spec.InitContainers {
+		harden(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		harden(&spec.Containers[i])
+	}
+}
+
+// podSecurityContext returns the security context of the pods of bestie.
+func (r *BestieReconciler) podSecurityContext(bestie *petsv2.Bestie) *corev1.PodSecurityContext {
+	if sc := bestie.Spec.App.PodSecurityContext; sc != nil {
+		return sc.DeepCopy()
+	}
+	nonRoot := true
+	sc := &corev1.PodSecurityContext{
+		RunAsNonRoot:   &nonRoot,
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+	if !r.Platform.OpenShift {
+		user := defaultRunAsUser
+		sc.RunAsUser = &user
+	}
+	return sc
+}
+
+// containerSecurityContext returns the security context of the containers
+// of bestie.
+func containerSecurityContext(bestie *petsv2.Bestie) *corev1.SecurityContext {
+	if sc := bestie.Spec.App.SecurityContext; sc != nil {
+		return sc.DeepCopy()
+	}
+	escalation, readOnly := false, true
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &escalation,
+		ReadOnlyRootFilesystem:   &readOnly,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
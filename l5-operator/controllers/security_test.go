@@ -0,0 +1,65 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/platform"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetSecurityContext(t *testing.T) {
+	g := NewWithT(t)
+	bestie := &petsv2.Bestie{}
+	spec := &corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "init"}},
+		Containers:     []corev1.Container{{Name: appPods}},
+	}
+
+	r := &BestieReconciler{}
+	r.setSecurityContext(spec, bestie)
+	r.setSecurityContext(spec, bestie)
+	g.Expect(*spec.SecurityContext.RunAsNonRoot).To(BeTrue())
+	g.Expect(*spec.SecurityContext.RunAsUser).To(Equal(defaultRunAsUser))
+	g.Expect(spec.SecurityContext.SeccompProfile.Type).To(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+	g.Expect(spec.Volumes).To(Equal([]corev1.Volume{{Name: tmpVolume, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}))
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		g.Expect(*c.SecurityContext.AllowPrivilegeEscalation).To(BeFalse())
+		g.Expect(*c.SecurityContext.ReadOnlyRootFilesystem).To(BeTrue())
+		g.Expect(c.SecurityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")))
+		g.Expect(c.VolumeMounts).To(Equal([]corev1.VolumeMount{{Name: tmpVolume, MountPath: tmpPath}}))
+	}
+
+	// OpenShift assigns the user.
+	r.Platform = platform.Platform{OpenShift: true}
+	r.setSecurityContext(spec, bestie)
+	g.Expect(spec.SecurityContext.RunAsUser).To(BeNil())
+
+	// spec.app replaces the defaults, without a writable /tmp when the root
+	// filesystem is writable.
+	user, writable := int64(0), false
+	bestie.Spec.App.PodSecurityContext = &corev1.PodSecurityContext{RunAsUser: &user}
+	bestie.Spec.App.SecurityContext = &corev1.SecurityContext{ReadOnlyRootFilesystem: &writable}
+	r.setSecurityContext(spec, bestie)
+	g.Expect(spec.SecurityContext).To(Equal(bestie.Spec.App.PodSecurityContext))
+	g.Expect(spec.Containers[0].SecurityContext).To(Equal(bestie.Spec.App.SecurityContext))
+	g.Expect(spec.Volumes).To(BeEmpty())
+	g.Expect(spec.Containers[0].VolumeMounts).To(BeEmpty())
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/tracing"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// updateStatus refreshes the observed state of bestie and writes it back
+// when it changed. It only reads owned objects, so it is safe to call while
+// the Bestie is paused.
+func (r *BestieReconciler) updateStatus(ctx context.Context, bestie *petsv2.Bestie) (err error) {
+	ctx, span := r.tracer().Start(ctx, "Status")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	status := bestie.Status.DeepCopy()
+
+	status.PodStatus = "Pending"
+	if r.isRunning(ctx, bestie) {
+		status.PodStatus = "Running"
+	}
+
+	status.URL, status.ExposureType = r.exposedURL(ctx, bestie)
+	status.InternalServiceURL = r.internalServiceURL(ctx, bestie)
+	status.Rollout = r.rolloutStatus(ctx, bestie)
+	status.Database = r.databaseStatus(ctx, bestie)
+
+	meta.SetStatusCondition(&status.Conditions, pausedCondition(bestie))
+
+	maintenance := metav1.Condition{
+		Type:               petsv2.ConditionMaintenance,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: bestie.Generation,
+		Reason:             "AppServed",
+		Message:            "Traffic is served by the bestie app",
+	}
+	switch {
+	case bestie.Spec.Maintenance.Enabled:
+		maintenance.Status = metav1.ConditionTrue
+		maintenance.Reason = "MaintenanceEnabled"
+		maintenance.Message = "Traffic is served by the maintenance page"
+	case r.servesMaintenancePage(ctx, bestie):
+		maintenance.Status = metav1.ConditionTrue
+		maintenance.Reason = "WaitingForApp"
+		maintenance.Message = "Traffic is switched back once the bestie app is ready"
+	}
+	meta.SetStatusCondition(&status.Conditions, maintenance)
+
+	hibernated := metav1.Condition{
+		Type:               petsv2.ConditionHibernated,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: bestie.Generation,
+		Reason:             "Awake",
+		Message:            "The Bestie stack is running",
+	}
+	if hibernating, _, err := hibernationState(bestie, time.Now()); err != nil {
+		hibernated.Status = metav1.ConditionUnknown
+		hibernated.Reason = "InvalidSchedule"
+		hibernated.Message = err.Error()
+	} else if hibernating {
+		hibernated.Status = metav1.ConditionTrue
+		hibernated.Reason = "Hibernating"
+		hibernated.Message = "The app is scaled to zero and the database is shut down"
+	} else if prev := meta.FindStatusCondition(bestie.Status.Conditions, petsv2.ConditionHibernated); prev != nil && prev.Reason != "Awake" && status.PodStatus != "Running" {
+		// Still coming back from hibernation.
+		hibernated.Reason = "WakingUp"
+		hibernated.Message = "Waiting for the database and then the app to become ready"
+	}
+	meta.SetStatusCondition(&status.Conditions, hibernated)
+
+	database, err := r.databaseReadiness(ctx, bestie)
+	if err != nil {
+		return err
+	}
+	meta.SetStatusCondition(&status.Conditions, database)
+
+	if equality.Semantic.DeepEqual(status, &bestie.Status) {
+		return nil
+	}
+	bestie.Status = *status
+	return r.Status().Update(ctx, bestie)
+}
+
+// pausedCondition returns the Paused condition of bestie, which is paused
+// through spec.paused or the paused annotation.
+func pausedCondition(bestie *petsv2.Bestie) metav1.Condition {
+	paused := metav1.Condition{
+		Type:               petsv2.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: bestie.Generation,
+		Reason:             "Reconciling",
+		Message:            "The operator is reconciling this Bestie",
+	}
+	if bestie.IsPaused() {
+		paused.Status = metav1.ConditionTrue
+		paused.Reason = "Paused"
+		paused.Message = "Reconciliation is paused, no objects are changed until it is resumed"
+	}
+	return paused
+}
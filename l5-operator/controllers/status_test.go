@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPausedCondition(t *testing.T) {
+	tests := []struct {
+		name        string
+		paused      bool
+		annotations map[string]string
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+	}{
+		{
+			name:       "reconciling",
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "Reconciling",
+		},
+		{
+			name:       "spec.paused",
+			paused:     true,
+			wantStatus: metav1.ConditionTrue,
+			wantReason: "Paused",
+		},
+		{
+			name:        "paused annotation",
+			annotations: map[string]string{petsv2.PausedAnnotation: "true"},
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  "Paused",
+		},
+		{
+			name:        "paused annotation not true",
+			annotations: map[string]string{petsv2.PausedAnnotation: "yes"},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "Reconciling",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			bestie := &petsv2.Bestie{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2, Annotations: tt.annotations},
+				Spec:       petsv2.BestieSpec{Paused: tt.paused},
+			}
+			condition := pausedCondition(bestie)
+			g.Expect(condition.Type).To(Equal(petsv2.ConditionPaused))
+			g.Expect(condition.Status).To(Equal(tt.wantStatus))
+			g.Expect(condition.Reason).To(Equal(tt.wantReason))
+			g.Expect(condition.ObservedGeneration).To(Equal(int64(2)))
+		})
+	}
+}
@@ -0,0 +1,354 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// servingCertVolume is mounted at servingCertPath in the pods serving
+	// HTTPS to the router when TLS is reencrypted.
+	servingCertVolume = "serving-cert"
+	servingCertPath   = "/etc/bestie/tls"
+
+	// openShiftServingCertAnnotation has the OpenShift service CA issue a
+	// certificate for a Service into the named Secret.
+	openShiftServingCertAnnotation = "service.beta.openshift.io/serving-cert-secret-name"
+
+	// The annotations asking ingress controllers to reencrypt: the first is
+	// read by ingress-nginx, the second when OpenShift turns the Ingress into
+	// a Route.
+	nginxBackendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+	routeTerminationAnnotation     = "route.openshift.io/termination"
+
+	// gunicornArgs are the arguments the app server runs with, to which the
+	// certificate is added when the app serves HTTPS.
+	gunicornArgs = "--bind=0.0.0.0 --workers=3"
+)
+
+// certificateGVK is the kind of cert-manager Certificates. They are handled
+// as unstructured objects, as cert-manager may not be installed.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+
+// newCertificate returns an empty cert-manager Certificate.
+func newCertificate() *unstructured.Unstructured {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	return cert
+}
+
+// reencrypt returns whether the router reencrypts the traffic to the app,
+// which then serves HTTPS itself.
+func reencrypt(bestie *petsv2.Bestie) bool {
+	tls := bestie.Spec.Expose.TLS
+	return tls != nil && tls.Termination == petsv2.TLSTerminationReencrypt
+}
+
+// publicCertSecret returns the Secret holding the certificate served to
+// clients, or "" when the router serves its default certificate.
+func publicCertSecret(bestie *petsv2.Bestie) string {
+	tls := bestie.Spec.Expose.TLS
+	if tls == nil {
+		return ""
+	}
+	switch tls.Certificate.EffectiveSource() {
+	case petsv2.CertificateFromSecret:
+		return tls.Certificate.SecretName
+	case petsv2.CertificateFromCertManager:
+		return bestie.Name + "-tls"
+	}
+	return ""
+}
+
+// servingCertSecret returns the Secret holding the certificate the app
+// serves to the router when TLS is reencrypted.
+func servingCertSecret(bestie *petsv2.Bestie) string {
+	return bestie.Name + "-serving-cert"
+}
+
+// servicePort returns the port of the bestie Service: that of
+// spec.expose.service, or else the default one of its scheme.
+func servicePort(bestie *petsv2.Bestie) int32 {
+	if port := bestie.Spec.Expose.Service.Port; port != 0 {
+		return port
+	}
+	if reencrypt(bestie) {
+		return 443
+	}
+	return 80
+}
+
+// reconcileCertificates creates the cert-manager Certificates bestie needs:
+// the one served to clients with the CertManager source and, outside
+// OpenShift, the one the app serves to the router when TLS is reencrypted.
+// Certificates no longer needed are removed.
+func (r *BestieReconciler) reconcileCertificates(ctx context.Context, req ctrl.Request, bestie *petsv2.Bestie) error {
+	public, serving := r.desiredCertificates(bestie)
+	if !r.Platform.CertManager {
+		if public != nil || serving != nil {
+			return errors.New("spec.expose.tls needs cert-manager, which is not installed")
+		}
+		return nil
+	}
+
+	if public != nil {
+		if err := r.reconcileDesired(ctx, req, bestie, *public); err != nil {
+			return err
+		}
+	} else if err := r.removeComponent(ctx, bestie, "Certificate", newCertificate(), "-tls"); err != nil {
+		return err
+	}
+
+	if serving != nil {
+		return r.reconcileDesired(ctx, req, bestie, *serving)
+	}
+	return r.removeComponent(ctx, bestie, "ServingCertificate", newCertificate(), "-serving-cert")
+}
+
+// desiredCertificates returns the Certificates cert-manager issues for
+// bestie: the public one of its host and the serving one of the bestie
+// Service, each nil when bestie does not need it.
+func (r *BestieReconciler) desiredCertificates(bestie *petsv2.Bestie) (public, serving *component) {
+	if tls := bestie.Spec.Expose.TLS; tls != nil && tls.Certificate.EffectiveSource() == petsv2.CertificateFromCertManager {
+		cert := newCertificate()
+		public = &component{kind: "Certificate", obj: cert, suffix: "-tls", manifest: certificateManifest, mutate: func() error {
+			return setCertificate(cert, bestie, publicCertSecret(bestie), []string{bestie.Spec.Expose.Host})
+		}}
+	}
+	if reencrypt(bestie) && !r.Platform.OpenShift {
+		cert := newCertificate()
+		serving = &component{kind: "ServingCertificate", obj: cert, suffix: "-serving-cert", manifest: certificateManifest, mutate: func() error {
+			return setCertificate(cert, bestie, servingCertSecret(bestie), serviceDNSNames(bestie))
+		}}
+	}
+	return public, serving
+}
+
+// setCertificate has cert-manager issue a certificate for dnsNames into the
+// Secret named name, which gets the labels of bestie so that the operator
+// sees it change.
+func setCertificate(cert *unstructured.Unstructured, bestie *petsv2.Bestie, name string, dnsNames []string) error {
+	ref := bestie.Spec.Expose.TLS.Certificate.IssuerRef
+	if ref == nil {
+		return errors.New("spec.expose.tls.certificate.issuerRef is required to issue certificates with cert-manager")
+	}
+	kind := ref.Kind
+	if kind == "" {
+		kind = petsv2.IssuerKind
+	}
+
+	// The manifest names every Certificate alike; name it after its Secret.
+	cert.SetName(name)
+	if err := unstructured.SetNestedField(cert.Object, name, "spec", "secretName"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedStringSlice(cert.Object, dnsNames, "spec", "dnsNames"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedStringMap(cert.Object, map[string]string{
+		"name":  ref.Name,
+		"kind":  kind,
+		"group": certificateGVK.Group,
+	}, "spec", "issuerRef"); err != nil {
+		return err
+	}
+	return unstructured.SetNestedStringMap(cert.Object, labelsFor(bestie), "spec", "secretTemplate", "labels")
+}
+
+// serviceDNSNames returns the names the bestie Service is reachable at.
+func serviceDNSNames(bestie *petsv2.Bestie) []string {
+	name := bestie.Name + "-service"
+	return []string{
+		name,
+		name + "." + bestie.Namespace,
+		name + "." + bestie.Namespace + ".svc",
+		name + "." + bestie.Namespace + ".svc.cluster.local",
+	}
+}
+
+// routeCertificate returns the Secret with the certificate a Route embeds,
+// or nil when the router serves its default certificate. It is also nil
+// while cert-manager has not issued the certificate yet.
+func (r *BestieReconciler) routeCertificate(ctx context.Context, bestie *petsv2.Bestie) (*corev1.Secret, error) {
+	name := publicCertSecret(bestie)
+	if name == "" {
+		return nil, nil
+	}
+	// Secrets the operator did not label are not in the cache.
+	secret := &corev1.Secret{}
+	if err := r.reader().Get(ctx, types.NamespacedName{Name: name, Namespace: bestie.Namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) && bestie.Spec.Expose.TLS.Certificate.EffectiveSource() == petsv2.CertificateFromCertManager {
+			ctrllog.FromContext(ctx).Info("Waiting for cert-manager to issue the certificate", "secret", name)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read the certificate of spec.expose.tls: %w", err)
+	}
+	return secret, nil
+}
+
+// setRoute sets the host and TLS configuration of the Route. cert is the
+// Secret with the certificate to serve, nil for the router default.
+func setRoute(route *routev1.Route, bestie *petsv2.Bestie, cert *corev1.Secret) {
+	if host := bestie.Spec.Expose.Host; host != "" {
+		route.Spec.Host = host
+	}
+	tls := bestie.Spec.Expose.TLS
+	if tls == nil {
+		route.Spec.TLS = nil
+		return
+	}
+
+	termination := routev1.TLSTerminationEdge
+	if tls.Termination == petsv2.TLSTerminationReencrypt {
+		termination = routev1.TLSTerminationReencrypt
+	}
+	config := &routev1.TLSConfig{
+		Termination:                   termination,
+		InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+	}
+	if route.Spec.TLS != nil {
+		// Left empty, OpenShift trusts the service CA for reencryption.
+		config.DestinationCACertificate = route.Spec.TLS.DestinationCACertificate
+	}
+	if cert != nil {
+		config.Certificate = string(cert.Data[corev1.TLSCertKey])
+		config.Key = string(cert.Data[corev1.TLSPrivateKeyKey])
+		config.CACertificate = string(cert.Data["ca.crt"])
+	}
+	route.Spec.TLS = config
+}
+
+// setIngress sets the host, TLS configuration and backend port of the Ingress.
+func setIngress(ingress *networkingv1.Ingress, bestie *petsv2.Bestie) {
+	host := bestie.Spec.Expose.Host
+	port := servicePort(bestie)
+	for i := range ingress.Spec.Rules {
+		rule := &ingress.Spec.Rules[i]
+		rule.Host = host
+		if rule.HTTP == nil {
+			continue
+		}
+		for j := range rule.HTTP.Paths {
+			if service := rule.HTTP.Paths[j].Backend.Service; service != nil {
+				service.Port = networkingv1.ServiceBackendPort{Number: port}
+			}
+		}
+	}
+
+	ingress.Spec.TLS = nil
+	if bestie.Spec.Expose.TLS != nil {
+		tls := networkingv1.IngressTLS{SecretName: publicCertSecret(bestie)}
+		if host != "" {
+			tls.Hosts = []string{host}
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{tls}
+	}
+
+	annotations := ingress.GetAnnotations()
+	if reencrypt(bestie) {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[nginxBackendProtocolAnnotation] = "HTTPS"
+		annotations[routeTerminationAnnotation] = string(routev1.TLSTerminationReencrypt)
+	} else {
+		delete(annotations, nginxBackendProtocolAnnotation)
+		delete(annotations, routeTerminationAnnotation)
+	}
+	ingress.SetAnnotations(annotations)
+}
+
+// setServingCert has the named container of the pod spec serve HTTPS with
+// the serving certificate when TLS is reencrypted, and plain HTTP otherwise.
+func setServingCert(spec *corev1.PodSpec, container string, bestie *petsv2.Bestie) {
+	enabled := reencrypt(bestie)
+
+	volumes := spec.Volumes[:0]
+	for _, v := range spec.Volumes {
+		if v.Name != servingCertVolume {
+			volumes = append(volumes, v)
+		}
+	}
+	if enabled {
+		volumes = append(volumes, corev1.Volume{
+			Name: servingCertVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: servingCertSecret(bestie)},
+			},
+		})
+	}
+	spec.Volumes = volumes
+
+	scheme := corev1.URISchemeHTTP
+	if enabled {
+		scheme = corev1.URISchemeHTTPS
+	}
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		if c.Name != container {
+			continue
+		}
+		mounts := c.VolumeMounts[:0]
+		for _, m := range c.VolumeMounts {
+			if m.Name != servingCertVolume {
+				mounts = append(mounts, m)
+			}
+		}
+		if enabled {
+			mounts = append(mounts, corev1.VolumeMount{Name: servingCertVolume, MountPath: servingCertPath, ReadOnly: true})
+		}
+		c.VolumeMounts = mounts
+		if c.ReadinessProbe != nil && c.ReadinessProbe.HTTPGet != nil {
+			c.ReadinessProbe.HTTPGet.Scheme = scheme
+		}
+	}
+}
+
+// setAppServerTLS has gunicorn in the app container serve the mounted
+// serving certificate when TLS is reencrypted.
+func setAppServerTLS(spec *corev1.PodSpec, bestie *petsv2.Bestie) {
+	args := gunicornArgs
+	if reencrypt(bestie) {
+		args += fmt.Sprintf(" --certfile=%s/%s --keyfile=%s/%s", servingCertPath, corev1.TLSCertKey, servingCertPath, corev1.TLSPrivateKeyKey)
+	}
+	for i := range spec.Containers {
+		if spec.Containers[i].Name != appPods {
+			continue
+		}
+		for j := range spec.Containers[i].Env {
+			if env := &spec.Containers[i].Env[j]; env.Name == "GUNICORN_CMD_ARGS" {
+				env.Value = args
+			}
+		}
+	}
+}
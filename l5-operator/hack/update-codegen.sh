@@ -0,0 +1,53 @@
+#!/usr/bin/env bash
+
+# Regenerates the typed clientset, listers and informers of the Bestie API in
+# pkg/client. Run through `make client`, which installs the generators.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+BIN=${BIN:-${ROOT}/bin}
+MODULE=github.com/opdev/l5-operator-demo/l5-operator
+HEADER=${ROOT}/hack/boilerplate.go.txt
+
+# client-gen takes the API group from the parent directory of the version
+# and reads a parent named "api" as the core group. Expose api/v1 under a
+# pets/v1 link while generating and point the output back at api/v1.
+LINK_DIR=${ROOT}/hack/codegen
+APIS=${MODULE}/hack/codegen/pets/v1
+mkdir -p "${LINK_DIR}/pets"
+ln -sfn ../../../api/v1 "${LINK_DIR}/pets/v1"
+
+OUTPUT_BASE=$(mktemp -d)
+trap 'rm -rf "${OUTPUT_BASE}" "${LINK_DIR}"' EXIT
+
+cd "${ROOT}"
+
+"${BIN}/client-gen" \
+  --clientset-name versioned \
+  --input-base "" \
+  --input "${APIS}" \
+  --output-package "${MODULE}/pkg/client/clientset" \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file "${HEADER}"
+
+"${BIN}/lister-gen" \
+  --input-dirs "${APIS}" \
+  --output-package "${MODULE}/pkg/client/listers" \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file "${HEADER}"
+
+"${BIN}/informer-gen" \
+  --input-dirs "${APIS}" \
+  --versioned-clientset-package "${MODULE}/pkg/client/clientset/versioned" \
+  --listers-package "${MODULE}/pkg/client/listers" \
+  --output-package "${MODULE}/pkg/client/informers" \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file "${HEADER}"
+
+rm -rf "${ROOT}/pkg/client"
+cp -r "${OUTPUT_BASE}/${MODULE}/pkg/client" "${ROOT}/pkg/client"
+grep -rl "${APIS}" "${ROOT}/pkg/client" | xargs sed -i "s|${APIS}|${MODULE}/api/v1|g"
+gofmt -w "${ROOT}/pkg/client"
@@ -17,8 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -33,8 +37,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	configv1alpha1 "github.com/opdev/l5-operator-demo/l5-operator/api/config/v1alpha1"
 	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
 	"github.com/opdev/l5-operator-demo/l5-operator/controllers"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/platform"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -48,46 +56,153 @@ func init() {
 	utilruntime.Must(routev1.AddToScheme(scheme))
 	utilruntime.Must(pgov1.AddToScheme(scheme))
 	utilruntime.Must(petsv1.AddToScheme(scheme))
+	utilruntime.Must(petsv2.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
+// managerOptions returns the manager options loaded from configFile, if
+// any, into operatorConfig. The flags set explicitly on fs override the
+// config file, and the flag defaults fill in what neither sets.
+func managerOptions(fs *flag.FlagSet, configFile string, operatorConfig *configv1alpha1.BestieOperatorConfig) (ctrl.Options, error) {
+	options := ctrl.Options{Scheme: scheme}
+	if configFile != "" {
+		var err error
+		options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile).OfKind(operatorConfig))
+		if err != nil {
+			return options, err
+		}
+	}
+	// AndFrom only fills in unset options, and false is unset for
+	// leader election, so the flags are applied after it.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "metrics-bind-address":
+			options.MetricsBindAddress = f.Value.String()
+		case "health-probe-bind-address":
+			options.HealthProbeBindAddress = f.Value.String()
+		case "leader-elect":
+			options.LeaderElection = f.Value.(flag.Getter).Get().(bool)
+		}
+	})
+	// Fall back to the flag defaults for anything neither source has set.
+	if options.MetricsBindAddress == "" {
+		options.MetricsBindAddress = fs.Lookup("metrics-bind-address").Value.String()
+	}
+	if options.HealthProbeBindAddress == "" {
+		options.HealthProbeBindAddress = fs.Lookup("health-probe-bind-address").Value.String()
+	}
+	if options.Port == 0 {
+		options.Port = 9443
+	}
+	if options.LeaderElectionID == "" {
+		options.LeaderElectionID = "9b140e36.bestie.com"
+	}
+	return options, nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := render(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var watchNamespace string
+	flag.StringVar(&configFile, "config", "",
+		"The controller will load its initial configuration from this file. "+
+			"Omit this flag to use the default configuration values. "+
+			"Command-line flags override configuration from this file.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&watchNamespace, "watch-namespace", os.Getenv("WATCH_NAMESPACE"),
+		"Comma-separated list of namespaces to watch. Defaults to the WATCH_NAMESPACE environment variable. "+
+			"All namespaces are watched when empty.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
+	var tracingOpts tracing.Options
+	tracingOpts.BindFlags(flag.CommandLine)
+	var controllerOpts controllers.ControllerOptions
+	controllerOpts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "9b140e36.bestie.com",
-	})
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			setupLog.Error(err, "unable to flush traces")
+		}
+	}()
+	if tracingOpts.Enabled() {
+		setupLog.Info("exporting traces", "endpoint", tracingOpts.Endpoint)
+	}
+
+	operatorConfig := configv1alpha1.BestieOperatorConfig{}
+	options, err := managerOptions(flag.CommandLine, configFile, &operatorConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to load the config file")
+		os.Exit(1)
+	}
+	operatorConfig.Defaults.SetDefaults()
+
+	namespaces := watchNamespaces(watchNamespace)
+	options.NewCache = controllers.NewCache(namespaces)
+	if len(namespaces) > 0 {
+		setupLog.Info("restricting the manager to namespaces", "namespaces", namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	clusterPlatform, err := platform.Detect(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to detect the cluster platform")
+		os.Exit(1)
+	}
+	setupLog.Info("detected the cluster platform", "openshift", clusterPlatform.OpenShift, "certManager", clusterPlatform.CertManager, "gatewayAPI", clusterPlatform.GatewayAPI)
+
 	if err = (&controllers.BestieReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:     tracing.WrapClient(mgr.GetClient(), tracing.Tracer()),
+		Scheme:     mgr.GetScheme(),
+		APIReader:  mgr.GetAPIReader(),
+		Tracer:     tracing.Tracer(),
+		Defaults:   operatorConfig.Defaults,
+		Platform:   clusterPlatform,
+		Controller: controllerOpts,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Bestie")
 		os.Exit(1)
 	}
+	// Webhooks need serving certificates, which are usually missing when the
+	// manager runs locally. Set ENABLE_WEBHOOKS=false to skip them there.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		defaults := webhookDefaults(operatorConfig.Defaults, clusterPlatform)
+		if err = (&petsv2.Bestie{}).SetupWebhookWithManager(mgr, defaults); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Bestie")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -105,3 +220,26 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// webhookDefaults returns the values the defaulting webhook fills in.
+func webhookDefaults(defaults configv1alpha1.BestieDefaults, clusterPlatform platform.Platform) petsv2.WebhookDefaults {
+	return petsv2.WebhookDefaults{
+		AppImage:        defaults.AppImage,
+		AppVersion:      defaults.AppVersion,
+		AppResources:    defaults.AppResources,
+		DatabaseStorage: defaults.DatabaseStorage,
+		BackupSchedule:  defaults.BackupSchedule,
+		ExposeType:      controllers.DefaultExposeType(clusterPlatform.OpenShift),
+	}
+}
+
+// watchNamespaces splits a comma-separated namespace list, dropping blanks.
+func watchNamespaces(value string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	configv1alpha1 "github.com/opdev/l5-operator-demo/l5-operator/api/config/v1alpha1"
+)
+
+// TestManagerOptions checks that flags set on the command line win over the
+// config file, which wins over the flag defaults.
+func TestManagerOptions(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	NewWithT(t).Expect(os.WriteFile(configFile, []byte(`apiVersion: config.bestie.com/v1alpha1
+kind: BestieOperatorConfig
+metrics:
+  bindAddress: 127.0.0.1:8080
+leaderElection:
+  leaderElect: true
+defaults:
+  appVersion: "1.1"
+`), 0o600)).To(Succeed())
+
+	tests := []struct {
+		name        string
+		args        []string
+		configFile  string
+		wantMetrics string
+		wantProbe   string
+		wantLeader  bool
+	}{
+		{
+			name:        "flag defaults",
+			wantMetrics: ":8080",
+			wantProbe:   ":8081",
+		},
+		{
+			name:        "config file",
+			configFile:  configFile,
+			wantMetrics: "127.0.0.1:8080",
+			wantProbe:   ":8081",
+			wantLeader:  true,
+		},
+		{
+			name:        "flags over the config file",
+			args:        []string{"--metrics-bind-address=:9090", "--leader-elect=false"},
+			configFile:  configFile,
+			wantMetrics: ":9090",
+			wantProbe:   ":8081",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			fs := flag.NewFlagSet("manager", flag.ContinueOnError)
+			fs.String("metrics-bind-address", ":8080", "")
+			fs.String("health-probe-bind-address", ":8081", "")
+			fs.Bool("leader-elect", false, "")
+			g.Expect(fs.Parse(tt.args)).To(Succeed())
+
+			operatorConfig := configv1alpha1.BestieOperatorConfig{}
+			options, err := managerOptions(fs, tt.configFile, &operatorConfig)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(options.MetricsBindAddress).To(Equal(tt.wantMetrics))
+			g.Expect(options.HealthProbeBindAddress).To(Equal(tt.wantProbe))
+			g.Expect(options.LeaderElection).To(Equal(tt.wantLeader))
+			g.Expect(options.Port).To(Equal(9443))
+			if tt.configFile != "" {
+				g.Expect(operatorConfig.Defaults.AppVersion).To(Equal("1.1"))
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package platform detects the optional APIs of the cluster the operator
+// runs on, so it only renders and watches objects the cluster can serve.
+package platform
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// RouteGroupVersion is the OpenShift Route API.
+const (
+	RouteGroupVersion       = "route.openshift.io/v1"
+	CertManagerGroupVersion = "cert-manager.io/v1"
+	GatewayAPIGroupVersion  = "gateway.networking.k8s.io/v1beta1"
+)
+
+// Platform lists the optional APIs served by the cluster.
+type Platform struct {
+	// OpenShift is true when the cluster serves OpenShift Routes.
+	OpenShift bool
+	// CertManager is true when the cluster serves cert-manager Certificates.
+	CertManager bool
+	// GatewayAPI is true when the cluster serves Gateway API HTTPRoutes.
+	GatewayAPI bool
+}
+
+// Detect queries the API server of cfg for the optional APIs.
+func Detect(cfg *rest.Config) (Platform, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return Platform{}, err
+	}
+	return DetectWith(dc)
+}
+
+// DetectWith queries the given discovery client for the optional APIs.
+func DetectWith(dc discovery.DiscoveryInterface) (Platform, error) {
+	var p Platform
+	var err error
+	if p.OpenShift, err = serves(dc, RouteGroupVersion, "Route"); err != nil {
+		return Platform{}, err
+	}
+	if p.CertManager, err = serves(dc, CertManagerGroupVersion, "Certificate"); err != nil {
+		return Platform{}, err
+	}
+	if p.GatewayAPI, err = serves(dc, GatewayAPIGroupVersion, "HTTPRoute"); err != nil {
+		return Platform{}, err
+	}
+	return p, nil
+}
+
+// serves returns whether the API server serves kind in groupVersion.
+func serves(dc discovery.DiscoveryInterface, groupVersion, kind string) (bool, error) {
+	resources, err := dc.ServerResourcesForGroupVersion(groupVersion)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Kind == kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
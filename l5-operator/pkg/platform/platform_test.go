@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDetectWith(t *testing.T) {
+	g := NewWithT(t)
+
+	dc := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	p, err := DetectWith(dc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p).To(Equal(Platform{}))
+
+	dc.Resources = []*metav1.APIResourceList{{
+		GroupVersion: RouteGroupVersion,
+		APIResources: []metav1.APIResource{{Name: "routes", Kind: "Route"}},
+	}}
+	p, err = DetectWith(dc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p.OpenShift).To(BeTrue())
+	g.Expect(p.CertManager).To(BeFalse())
+
+	dc.Resources = append(dc.Resources, &metav1.APIResourceList{
+		GroupVersion: CertManagerGroupVersion,
+		APIResources: []metav1.APIResource{{Name: "certificates", Kind: "Certificate"}},
+	})
+	p, err = DetectWith(dc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p).To(Equal(Platform{OpenShift: true, CertManager: true}))
+
+	dc.Resources = []*metav1.APIResourceList{{
+		GroupVersion: GatewayAPIGroupVersion,
+		APIResources: []metav1.APIResource{{Name: "gateways", Kind: "Gateway"}, {Name: "httproutes", Kind: "HTTPRoute"}},
+	}}
+	p, err = DetectWith(dc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p).To(Equal(Platform{GatewayAPI: true}))
+}
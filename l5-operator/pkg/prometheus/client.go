@@ -0,0 +1,138 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prometheus queries the HTTP API of Prometheus, or of a compatible
+// server such as Thanos Querier, for the canary analysis.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds the queries of a Client without an HTTPClient, so
+// that an unresponsive server does not stall the reconcile loop.
+const DefaultTimeout = 30 * time.Second
+
+// defaultHTTPClient sends the queries of a Client without an HTTPClient.
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// Client runs instant queries against a Prometheus-compatible HTTP API.
+type Client struct {
+	// Address is the base URL of the API, e.g. http://prometheus:9090.
+	Address string
+	// BearerToken, when set, authenticates the queries.
+	BearerToken string
+	// HTTPClient sends the queries. It defaults to a client timing out
+	// after DefaultTimeout.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the API at address.
+func NewClient(address string) *Client {
+	return &Client{Address: address}
+}
+
+// response is the envelope of every API response.
+type response struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query returns the value of the instant query at the given time. A vector
+// result must hold a single sample. ok is false when the query has no
+// result, or its value is not a number, e.g. a rate over no requests.
+func (c *Client) Query(ctx context.Context, query string, at time.Time) (value float64, ok bool, err error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatFloat(float64(at.UnixNano())/1e9, 'f', 3, 64))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.Address, "/")+"/api/v1/query", strings.NewReader(params.Encode()))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	var body response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, false, fmt.Errorf("query %q: %s: %w", query, resp.Status, err)
+	}
+	if body.Status != "success" {
+		return 0, false, fmt.Errorf("query %q: %s: %s", query, body.ErrorType, body.Error)
+	}
+
+	var sample []interface{}
+	switch body.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return 0, false, fmt.Errorf("query %q: %w", query, err)
+		}
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result, &vector); err != nil {
+			return 0, false, fmt.Errorf("query %q: %w", query, err)
+		}
+		if len(vector) == 0 {
+			return 0, false, nil
+		}
+		if len(vector) > 1 {
+			return 0, false, fmt.Errorf("query %q: %d series, expected a single one", query, len(vector))
+		}
+		sample = vector[0].Value
+	default:
+		return 0, false, fmt.Errorf("query %q: unsupported result type %q", query, body.Data.ResultType)
+	}
+
+	// A sample is [<unix time>, "<value>"].
+	if len(sample) != 2 {
+		return 0, false, fmt.Errorf("query %q: malformed sample %v", query, sample)
+	}
+	s, _ := sample[1].(string)
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("query %q: %w", query, err)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
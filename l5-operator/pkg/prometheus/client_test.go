@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestQuery(t *testing.T) {
+	responses := map[string]string{
+		"vector":  `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1646136000,"0.25"]}]}}`,
+		"scalar":  `{"status":"success","data":{"resultType":"scalar","result":[1646136000,"3"]}}`,
+		"empty":   `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		"nan":     `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1646136000,"NaN"]}]}}`,
+		"series":  `{"status":"success","data":{"resultType":"vector","result":[{"value":[0,"1"]},{"value":[0,"2"]}]}}`,
+		"invalid": `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+	}
+	var token, at string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		at = r.FormValue("time")
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("query") == "invalid" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		fmt.Fprint(w, responses[r.FormValue("query")])
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		query   string
+		value   float64
+		ok      bool
+		wantErr string
+	}{
+		{query: "vector", value: 0.25, ok: true},
+		{query: "scalar", value: 3, ok: true},
+		{query: "empty"},
+		{query: "nan"},
+		{query: "series", wantErr: "2 series"},
+		{query: "invalid", wantErr: "parse error"},
+	}
+	c := &Client{Address: server.URL + "/", BearerToken: "secret"}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			g := NewWithT(t)
+			value, ok, err := c.Query(context.Background(), tt.query, time.Unix(1646136000, 0))
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(value).To(Equal(tt.value))
+			g.Expect(ok).To(Equal(tt.ok))
+			g.Expect(token).To(Equal("Bearer secret"))
+			g.Expect(at).To(Equal("1646136000.000"))
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// WrapClient returns a client that records a child span for every API call
+// made through c. A nil tracer falls back to the global operator tracer.
+func WrapClient(c client.Client, tracer trace.Tracer) client.Client {
+	if tracer == nil {
+		tracer = Tracer()
+	}
+	return &tracingClient{Client: c, tracer: tracer}
+}
+
+type tracingClient struct {
+	client.Client
+	tracer trace.Tracer
+}
+
+// start opens a span named after the verb and kind of obj, e.g. "Get Deployment".
+func (c *tracingClient) start(ctx context.Context, verb string, obj runtime.Object, key client.ObjectKey) (context.Context, trace.Span) {
+	kind := "Unknown"
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+
+	attrs := []attribute.KeyValue{ObjectKindKey.String(kind)}
+	if key.Name != "" {
+		attrs = append(attrs, ObjectNameKey.String(key.Name))
+	}
+	if key.Namespace != "" {
+		attrs = append(attrs, ObjectNamespaceKey.String(key.Namespace))
+	}
+
+	return c.tracer.Start(ctx, verb+" "+kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) (err error) {
+	ctx, span := c.start(ctx, "Get", obj, key)
+	defer func() { EndSpan(span, err) }()
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	ctx, span := c.start(ctx, "List", list, client.ObjectKey{})
+	defer func() { EndSpan(span, err) }()
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, span := c.start(ctx, "Create", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := c.start(ctx, "Delete", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := c.start(ctx, "Update", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := c.start(ctx, "Patch", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) (err error) {
+	ctx, span := c.start(ctx, "DeleteAllOf", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Status() client.StatusWriter {
+	return &tracingStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+type tracingStatusWriter struct {
+	client.StatusWriter
+	client *tracingClient
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := w.client.start(ctx, "UpdateStatus", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := w.client.start(ctx, "PatchStatus", obj, client.ObjectKeyFromObject(obj))
+	defer func() { EndSpan(span, err) }()
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing wires OpenTelemetry tracing into the operator. Tracing is
+// optional: unless an OTLP endpoint is configured every span is a no-op.
+package tracing
+
+import (
+	"context"
+	"flag"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name used for every span the operator emits.
+const TracerName = "github.com/opdev/l5-operator-demo/l5-operator"
+
+// Attribute keys attached to reconcile and API call spans.
+const (
+	BestieNameKey       = attribute.Key("bestie.name")
+	BestieNamespaceKey  = attribute.Key("bestie.namespace")
+	BestieGenerationKey = attribute.Key("bestie.generation")
+
+	ObjectKindKey      = attribute.Key("k8s.object.kind")
+	ObjectNameKey      = attribute.Key("k8s.object.name")
+	ObjectNamespaceKey = attribute.Key("k8s.object.namespace")
+)
+
+// Options configures the OTLP trace exporter.
+type Options struct {
+	// Endpoint is the host:port of an OTLP gRPC collector. Tracing is
+	// disabled when it is empty.
+	Endpoint string
+	// Insecure disables TLS towards the collector, e.g. for a local collector.
+	Insecure bool
+	// SampleRatio is the fraction of reconciles that are sampled.
+	SampleRatio float64
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+}
+
+// BindFlags binds the tracing options to the given flagset.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Endpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP gRPC collector to export traces to. Tracing is disabled when empty.")
+	fs.BoolVar(&o.Insecure, "otlp-insecure", false,
+		"Disable TLS when connecting to the OTLP collector.")
+	fs.Float64Var(&o.SampleRatio, "trace-sample-ratio", 1.0,
+		"The fraction of reconciles to trace, between 0 and 1.")
+	fs.StringVar(&o.ServiceName, "trace-service-name", "l5-operator",
+		"The service name reported with every exported span.")
+}
+
+// Enabled returns whether an exporter endpoint has been configured.
+func (o Options) Enabled() bool {
+	return o.Endpoint != ""
+}
+
+// Setup installs a global TracerProvider exporting to the configured OTLP
+// endpoint. The returned function flushes and stops the provider and must be
+// called before the process exits. When tracing is disabled Setup leaves the
+// global no-op provider in place.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if !opts.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := NewTracerProvider(exporter, opts)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider returns a TracerProvider that batches spans to the given
+// exporter. Tests pass an in-memory exporter here.
+func NewTracerProvider(exporter sdktrace.SpanExporter, opts Options) *sdktrace.TracerProvider {
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = "l5-operator"
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+}
+
+// Tracer returns the operator tracer from the global TracerProvider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// EndSpan records err on the span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWrapClientRecordsAPICallSpans(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer(TracerName)
+
+	c := WrapClient(fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build(), tracer)
+
+	ctx, root := tracer.Start(context.Background(), "Reconcile")
+	dp := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "bestie-app", Namespace: "pets"}}
+	g.Expect(c.Create(ctx, dp)).To(Succeed())
+	err := c.Get(ctx, types.NamespacedName{Name: "missing", Namespace: "pets"}, &appsv1.Deployment{})
+	g.Expect(err).To(HaveOccurred())
+	root.End()
+
+	spans := exporter.GetSpans()
+	g.Expect(spans).To(HaveLen(3))
+
+	create, get := spans[0], spans[1]
+	g.Expect(create.Name).To(Equal("Create Deployment"))
+	g.Expect(create.Parent.SpanID()).To(Equal(root.SpanContext().SpanID()))
+	g.Expect(create.Attributes).To(ContainElements(
+		ObjectKindKey.String("Deployment"),
+		ObjectNameKey.String("bestie-app"),
+		ObjectNamespaceKey.String("pets"),
+	))
+
+	g.Expect(get.Name).To(Equal("Get Deployment"))
+	g.Expect(get.Status.Code).To(Equal(codes.Error))
+	g.Expect(get.Attributes).To(ContainElement(ObjectNameKey.String("missing")))
+}
+
+func TestSetupDisabledWithoutEndpoint(t *testing.T) {
+	g := NewWithT(t)
+
+	shutdown, err := Setup(context.Background(), Options{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(shutdown(context.Background())).To(Succeed())
+
+	_, span := Tracer().Start(context.Background(), "noop")
+	g.Expect(span.SpanContext().IsValid()).To(BeFalse())
+	span.End()
+}
+
+func TestNewTracerProviderSetsServiceName(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := NewTracerProvider(exporter, Options{SampleRatio: 1, ServiceName: "bestie-test"})
+	_, span := tp.Tracer(TracerName).Start(context.Background(), "Reconcile")
+	span.End()
+	g.Expect(tp.ForceFlush(context.Background())).To(Succeed())
+
+	spans := exporter.GetSpans()
+	g.Expect(spans).To(HaveLen(1))
+	g.Expect(spans[0].Resource.Attributes()).To(ContainElement(attribute.String("service.name", "bestie-test")))
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	configv1alpha1 "github.com/opdev/l5-operator-demo/l5-operator/api/config/v1alpha1"
+	petsv1 "github.com/opdev/l5-operator-demo/l5-operator/api/v1"
+	petsv2 "github.com/opdev/l5-operator-demo/l5-operator/api/v2"
+	"github.com/opdev/l5-operator-demo/l5-operator/controllers"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/platform"
+)
+
+// render runs `manager render`, which prints the objects the operator creates
+// for the Besties in a file without contacting a cluster. Like the manager,
+// it reads the resource manifests from config/resources in the working
+// directory.
+func render(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	var configFile string
+	var openShift bool
+	fs.StringVar(&configFile, "config", "",
+		"The operator configuration file to take the defaults from, as the manager does. "+
+			"Omit this flag to use the default configuration values.")
+	fs.BoolVar(&openShift, "openshift", false, "Render for OpenShift, where Besties are exposed through a Route by default.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render [flags] FILE\n\n"+
+			"Prints the objects the operator creates for the v1 or v2 Besties in FILE, or in stdin if FILE is -.\n\n"+
+			"Flags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one file")
+	}
+
+	operatorConfig := configv1alpha1.BestieOperatorConfig{}
+	if configFile != "" {
+		loader := ctrl.ConfigFile().AtPath(configFile).OfKind(&operatorConfig)
+		if err := loader.InjectScheme(scheme); err != nil {
+			return err
+		}
+		if _, err := loader.Complete(); err != nil {
+			return fmt.Errorf("unable to load the config file: %w", err)
+		}
+	}
+	operatorConfig.Defaults.SetDefaults()
+
+	in := stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	clusterPlatform := platform.Platform{OpenShift: openShift}
+	r := &controllers.BestieReconciler{
+		Scheme:   scheme,
+		Defaults: operatorConfig.Defaults,
+		Platform: clusterPlatform,
+	}
+	return renderBesties(in, stdout, r, webhookDefaults(operatorConfig.Defaults, clusterPlatform), time.Now())
+}
+
+// renderBesties reads the Besties in in, defaults and validates each one as
+// the webhooks would and writes the objects r renders for it to out, as a
+// stream of YAML documents.
+func renderBesties(in io.Reader, out io.Writer, r *controllers.BestieReconciler, defaults petsv2.WebhookDefaults, now time.Time) error {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := yamlutil.NewYAMLReader(bufio.NewReader(in))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return err
+		}
+		bestie, err := toHub(obj)
+		if err != nil {
+			return err
+		}
+		bestie.SetDefaults(defaults)
+		if err := bestie.ValidateCreate(); err != nil {
+			return err
+		}
+
+		objs, err := r.Render(context.Background(), bestie, now)
+		if err != nil {
+			return fmt.Errorf("bestie %s: %w", bestie.Name, err)
+		}
+		for _, obj := range objs {
+			b, err := yaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(out, "---\n%s", b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toHub returns obj as a v2 Bestie, converting it from v1 if needed.
+func toHub(obj runtime.Object) (*petsv2.Bestie, error) {
+	switch bestie := obj.(type) {
+	case *petsv2.Bestie:
+		return bestie, nil
+	case *petsv1.Bestie:
+		hub := &petsv2.Bestie{}
+		if err := bestie.ConvertTo(hub); err != nil {
+			return nil, err
+		}
+		hub.APIVersion, hub.Kind = petsv2.GroupVersion.String(), "Bestie"
+		return hub, nil
+	default:
+		return nil, fmt.Errorf("expected a Bestie, got %s", obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+}
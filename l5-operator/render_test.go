@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	configv1alpha1 "github.com/opdev/l5-operator-demo/l5-operator/api/config/v1alpha1"
+	"github.com/opdev/l5-operator-demo/l5-operator/controllers"
+	"github.com/opdev/l5-operator-demo/l5-operator/pkg/platform"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the render tests.")
+
+// TestRender renders every Bestie in testdata/render and compares the output
+// with the .golden file next to it. Inputs named openshift-* are rendered for
+// OpenShift. Run `go test . -run TestRender -update` after intended changes
+// to the rendered objects and review the diff of the golden files.
+func TestRender(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/render/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Inside the hibernation window of the hibernated input.
+	now := time.Date(2022, time.March, 1, 22, 0, 0, 0, time.UTC)
+
+	for _, input := range inputs {
+		input := input
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			g := NewWithT(t)
+
+			defaults := configv1alpha1.BestieDefaults{}
+			defaults.SetDefaults()
+			clusterPlatform := platform.Platform{OpenShift: strings.HasPrefix(filepath.Base(input), "openshift-")}
+			r := &controllers.BestieReconciler{Scheme: scheme, Defaults: defaults, Platform: clusterPlatform}
+
+			in, err := os.Open(input)
+			g.Expect(err).NotTo(HaveOccurred())
+			defer in.Close()
+			var out bytes.Buffer
+			g.Expect(renderBesties(in, &out, r, webhookDefaults(defaults, clusterPlatform), now)).To(Succeed())
+
+			golden := strings.TrimSuffix(input, ".yaml") + ".golden"
+			if *update {
+				g.Expect(os.WriteFile(golden, out.Bytes(), 0o644)).To(Succeed())
+			}
+			want, err := os.ReadFile(golden)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(out.String()).To(Equal(string(want)))
+		})
+	}
+}
+
+func TestRenderRejectsInvalidBestie(t *testing.T) {
+	g := NewWithT(t)
+
+	defaults := configv1alpha1.BestieDefaults{}
+	defaults.SetDefaults()
+	r := &controllers.BestieReconciler{Scheme: scheme, Defaults: defaults}
+	in := strings.NewReader(`
+apiVersion: pets.bestie.com/v2
+kind: Bestie
+metadata:
+  name: bestie
+spec:
+  agencyName: Animal Humane Society
+  app:
+    replicas: -1
+`)
+
+	err := renderBesties(in, &bytes.Buffer{}, r, webhookDefaults(defaults, platform.Platform{}), time.Now())
+	g.Expect(err).To(MatchError(ContainSubstring("spec.app.replicas")))
+}